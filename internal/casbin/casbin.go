@@ -0,0 +1,116 @@
+// Package casbin reads and writes Guardian's policy in the CSV format of
+// Casbin's file adapter, for enforcers using the RBAC with domains model in
+// Model, with the application as the domain.
+package casbin
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"guardian/internal/model"
+	"io"
+	"strings"
+)
+
+// Model is the model.conf matching the exported policy. A permission is the
+// policy object; Guardian has no separate actions.
+const Model = `[request_definition]
+r = sub, dom, obj
+
+[policy_definition]
+p = sub, dom, obj
+
+[role_definition]
+g = _, _, _
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = g(r.sub, p.sub, r.dom) && r.dom == p.dom && r.obj == p.obj
+`
+
+// Writer writes policy lines.
+type Writer struct {
+	w *csv.Writer
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: csv.NewWriter(w)}
+}
+
+// Policy writes "p, role, app, permission".
+func (w *Writer) Policy(roleID string, appID string, permID string) error {
+	return w.w.Write([]string{"p", roleID, appID, permID})
+}
+
+// Grouping writes "g, user, role, app".
+func (w *Writer) Grouping(userName string, roleID string, appID string) error {
+	return w.w.Write([]string{"g", userName, roleID, appID})
+}
+
+// Flush writes any buffered lines and reports the first write error.
+func (w *Writer) Flush() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+// Parse reads policy lines from r. Lines that are well-formed CSV but not a
+// three-value p or g line are returned as unmapped rather than failing the
+// parse; blank lines and # comments are skipped.
+func Parse(r io.Reader) ([]*model.CasbinRule, []*model.UnmappedLine, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	cr.Comment = '#'
+
+	rules := make([]*model.CasbinRule, 0)
+	unmapped := make([]*model.UnmappedLine, 0)
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return rules, unmapped, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		line, _ := cr.FieldPos(0)
+		for i := range record {
+			record[i] = strings.TrimSpace(record[i])
+		}
+		if len(record) == 1 && record[0] == "" {
+			continue
+		}
+
+		ptype, values := record[0], record[1:]
+		reason := ""
+		switch {
+		case ptype != "p" && ptype != "g":
+			reason = fmt.Sprintf("unsupported policy type %q", ptype)
+		case len(values) != 3:
+			reason = fmt.Sprintf("expected 3 values, got %d", len(values))
+		case values[0] == "" || values[1] == "" || values[2] == "":
+			reason = "empty value"
+		}
+		if reason != "" {
+			unmapped = append(unmapped, &model.UnmappedLine{Line: line, Text: strings.Join(record, ", "), Reason: reason})
+			continue
+		}
+
+		rule := &model.CasbinRule{Line: line, PType: ptype, Subject: values[0]}
+		if ptype == "p" {
+			rule.Domain, rule.Object = values[1], values[2]
+		} else {
+			rule.Object, rule.Domain = values[1], values[2]
+		}
+		rules = append(rules, rule)
+	}
+}
+
+// Text renders a rule back as its policy line.
+func Text(rule *model.CasbinRule) string {
+	if rule.PType == "p" {
+		return strings.Join([]string{"p", rule.Subject, rule.Domain, rule.Object}, ", ")
+	}
+	return strings.Join([]string{"g", rule.Subject, rule.Object, rule.Domain}, ", ")
+}
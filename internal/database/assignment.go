@@ -0,0 +1,289 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"guardian/internal/model"
+	"io"
+	"sort"
+)
+
+const (
+	// importBatchSize is how many rows are staged per statement.
+	importBatchSize = 1000
+	// maxRowErrors bounds the row errors an import reports.
+	maxRowErrors = 1000
+)
+
+// visibleAssignmentsSQL matches user_roles rows whose user and role are both
+// visible; hidden rows are left for a restore to bring back.
+const visibleAssignmentsSQL = `
+	EXISTS (SELECT 1 FROM users WHERE users.username = user_roles.username AND users.deleted_at IS NULL)
+	AND EXISTS (SELECT 1 FROM roles WHERE roles.id = user_roles.role_id AND roles.app_id = user_roles.app_id AND roles.deleted_at IS NULL)
+`
+
+// ExportAssignments streams every visible assignment, or only those of
+// appID unless it is empty, to fn in username, app_id, role_id order.
+func (service *service) ExportAssignments(ctx context.Context, appID string, fn func(*model.Assignment) error) error {
+	sql := "SELECT username, app_id, role_id FROM user_roles WHERE ($1 = '' OR app_id = $1) AND " + visibleAssignmentsSQL + " ORDER BY username, app_id, role_id"
+	rows, err := service.db.QueryContext(ctx, sql, appID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var a model.Assignment
+		if err := rows.Scan(&a.UserName, &a.AppID, &a.RoleID); err != nil {
+			return err
+		}
+		if err := fn(&a); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// ImportAssignments applies the assignments next returns, until io.EOF, in
+// one transaction. Rows are staged in batches and then validated and written
+// as sets rather than user by user. A non-empty appID confines the import,
+// rows and revocations alike, to that application. If any row names a
+// missing user or role, nothing is written and the rows are reported.
+func (service *service) ImportAssignments(ctx context.Context, mode string, appID string, next func() (*model.AssignmentRow, error)) (*model.AssignmentImport, error) {
+	switch mode {
+	case model.ImportAdd, model.ImportReplace, model.ImportSync:
+	default:
+		return nil, invalid("unknown import mode %q", mode)
+	}
+
+	result := &model.AssignmentImport{
+		Mode:    mode,
+		AppID:   appID,
+		Added:   make([]*model.Assignment, 0),
+		Removed: make([]*model.Assignment, 0),
+		Errors:  make([]*model.AssignmentRowError, 0),
+	}
+	rowError := func(row int, message string) {
+		if len(result.Errors) < maxRowErrors {
+			result.Errors = append(result.Errors, &model.AssignmentRowError{Row: row, Message: message})
+		}
+	}
+
+	err := service.withTx(ctx, func(tx *sql.Tx) error {
+		sql := "CREATE TEMP TABLE assignment_import (line INT NOT NULL, username TEXT NOT NULL, app_id TEXT NOT NULL, role_id TEXT NOT NULL) ON COMMIT DROP"
+		if _, err := tx.ExecContext(ctx, sql); err != nil {
+			return err
+		}
+
+		var batch []*model.AssignmentRow
+		flush := func() error {
+			if len(batch) == 0 {
+				return nil
+			}
+			rows := make([]int, len(batch))
+			userNames := make([]string, len(batch))
+			appIDs := make([]string, len(batch))
+			roleIDs := make([]string, len(batch))
+			for i, row := range batch {
+				rows[i], userNames[i], appIDs[i], roleIDs[i] = row.Row, row.UserName, row.AppID, row.RoleID
+			}
+			batch = batch[:0]
+			sql := "INSERT INTO assignment_import SELECT * FROM unnest($1::int[], $2::text[], $3::text[], $4::text[])"
+			_, err := tx.ExecContext(ctx, sql, rows, userNames, appIDs, roleIDs)
+			return err
+		}
+		for {
+			row, err := next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			result.Rows++
+			switch {
+			case row.UserName == "" || row.AppID == "" || row.RoleID == "":
+				rowError(row.Row, "username, app_id and role_id are required")
+				continue
+			case appID != "" && row.AppID != appID:
+				rowError(row.Row, "assignment is outside application "+appID)
+				continue
+			}
+			if batch = append(batch, row); len(batch) == importBatchSize {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		}
+		if err := flush(); err != nil {
+			return err
+		}
+		if result.Rows == 0 {
+			return invalid("import has no rows")
+		}
+
+		if err := service.checkAssignmentImport(ctx, tx, rowError); err != nil {
+			return err
+		}
+		if len(result.Errors) > 0 {
+			sort.SliceStable(result.Errors, func(i, j int) bool {
+				return result.Errors[i].Row < result.Errors[j].Row
+			})
+			return nil
+		}
+		return service.writeAssignmentImport(ctx, tx, result)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// checkAssignmentImport reports staged rows naming a user or role that does
+// not exist.
+func (service *service) checkAssignmentImport(ctx context.Context, tx *sql.Tx, rowError func(int, string)) error {
+	sql := `
+	SELECT
+		assignment_import.line,
+		assignment_import.username,
+		assignment_import.app_id,
+		assignment_import.role_id,
+		users.username IS NULL,
+		roles.id IS NULL
+	FROM
+		assignment_import
+	LEFT JOIN
+		users ON users.username = assignment_import.username AND users.deleted_at IS NULL
+	LEFT JOIN
+		roles ON roles.id = assignment_import.role_id AND roles.app_id = assignment_import.app_id AND roles.deleted_at IS NULL
+	WHERE
+		users.username IS NULL OR roles.id IS NULL
+	ORDER BY
+		assignment_import.line
+	LIMIT $1
+	`
+	rows, err := tx.QueryContext(ctx, sql, maxRowErrors)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var row int
+		var a model.Assignment
+		var noUser, noRole bool
+		if err := rows.Scan(&row, &a.UserName, &a.AppID, &a.RoleID, &noUser, &noRole); err != nil {
+			return err
+		}
+		if noUser {
+			rowError(row, describe(model.EntityUser, a.UserName, "")+" does not exist")
+		}
+		if noRole {
+			rowError(row, describe(model.EntityRole, a.RoleID, a.AppID)+" does not exist")
+		}
+	}
+	return rows.Err()
+}
+
+// writeAssignmentImport revokes what the mode calls for and grants the
+// staged assignments, then bumps the changed users. The audit log gets a
+// summary of the import and an entry per changed user, so no entry grows
+// with the size of the import.
+func (service *service) writeAssignmentImport(ctx context.Context, tx *sql.Tx, result *model.AssignmentImport) error {
+	if result.Mode != model.ImportAdd {
+		sql := `
+		DELETE FROM user_roles
+		WHERE ($1 = '' OR user_roles.app_id = $1)
+			AND ($2 OR user_roles.username IN (SELECT username FROM assignment_import))
+			AND NOT EXISTS (
+				SELECT 1 FROM assignment_import
+				WHERE assignment_import.username = user_roles.username
+					AND assignment_import.app_id = user_roles.app_id
+					AND assignment_import.role_id = user_roles.role_id
+			)
+			AND ` + visibleAssignmentsSQL + `
+		RETURNING username, app_id, role_id
+		`
+		removed, err := scanAssignments(tx.QueryContext(ctx, sql, result.AppID, result.Mode == model.ImportSync))
+		if err != nil {
+			return err
+		}
+		result.Removed = removed
+	}
+
+	sql := `
+	INSERT INTO user_roles (username, role_id, app_id)
+	SELECT DISTINCT username, role_id, app_id FROM assignment_import
+	ON CONFLICT DO NOTHING
+	RETURNING username, app_id, role_id
+	`
+	added, err := scanAssignments(tx.QueryContext(ctx, sql))
+	if err != nil {
+		return err
+	}
+	result.Added = added
+
+	if len(result.Added) == 0 && len(result.Removed) == 0 {
+		return nil
+	}
+	changes := make(map[string]*model.UserAssignmentChanges)
+	userNames := make([]string, 0)
+	userChanges := func(userName string) *model.UserAssignmentChanges {
+		if changes[userName] == nil {
+			changes[userName] = &model.UserAssignmentChanges{
+				Mode:    result.Mode,
+				Added:   make([]*model.Assignment, 0),
+				Removed: make([]*model.Assignment, 0),
+			}
+			userNames = append(userNames, userName)
+		}
+		return changes[userName]
+	}
+	for _, a := range result.Added {
+		c := userChanges(a.UserName)
+		c.Added = append(c.Added, a)
+	}
+	for _, a := range result.Removed {
+		c := userChanges(a.UserName)
+		c.Removed = append(c.Removed, a)
+	}
+	sort.Strings(userNames)
+
+	sql = "UPDATE users SET updated_at = NOW(), version = version + 1 WHERE username = ANY($1)"
+	if _, err := tx.ExecContext(ctx, sql, userNames); err != nil {
+		return err
+	}
+
+	summary := &model.AssignmentImportSummary{
+		Mode:    result.Mode,
+		AppID:   result.AppID,
+		Rows:    result.Rows,
+		Users:   len(userNames),
+		Added:   len(result.Added),
+		Removed: len(result.Removed),
+	}
+	if err := service.writeAudit(ctx, tx, model.AuditActionImport, model.EntityUser, "", result.AppID, nil, summary); err != nil {
+		return err
+	}
+	for _, userName := range userNames {
+		if err := service.writeAudit(ctx, tx, model.AuditActionImport, model.EntityUser, userName, result.AppID, nil, changes[userName]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func scanAssignments(rows *sql.Rows, err error) ([]*model.Assignment, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	assignments := make([]*model.Assignment, 0)
+	for rows.Next() {
+		var a model.Assignment
+		if err := rows.Scan(&a.UserName, &a.AppID, &a.RoleID); err != nil {
+			return nil, err
+		}
+		assignments = append(assignments, &a)
+	}
+	return assignments, rows.Err()
+}
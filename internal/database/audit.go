@@ -0,0 +1,392 @@
+package database
+
+import (
+	"compress/gzip"
+	"context"
+	dbsql "database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"guardian/internal/filter"
+	"guardian/internal/model"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type actorKey struct{}
+
+// WithActor attaches the identity performing a change to ctx. Every write in
+// Service records it in the audit log.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// actorFrom returns the identity attached by WithActor. Writes without one
+// are refused rather than attributed to nobody.
+func actorFrom(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+func upsertAction(exists bool) string {
+	if exists {
+		return model.AuditActionUpdate
+	}
+	return model.AuditActionCreate
+}
+
+// writeAudit appends an entry to audit_logs using q, which must be the
+// transaction that carried out the change. Appends are serialised by a
+// transaction-scoped advisory lock so that each entry can be chained to its
+// predecessor without gaps in seq.
+func (service *service) writeAudit(ctx context.Context, q querier, action string, entity string, entityID string, appID string, before interface{}, after interface{}) error {
+	if actorFrom(ctx) == "" {
+		return errors.New("audit: write without an actor")
+	}
+	beforeJSON, err := auditJSON(before)
+	if err != nil {
+		return err
+	}
+	afterJSON, err := auditJSON(after)
+	if err != nil {
+		return err
+	}
+
+	if _, err := q.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext('audit_logs'))"); err != nil {
+		return err
+	}
+
+	log := &model.AuditLog{
+		Actor:    actorFrom(ctx),
+		Action:   action,
+		Entity:   entity,
+		EntityID: entityID,
+		AppID:    appID,
+		Before:   rawJSON(beforeJSON),
+		After:    rawJSON(afterJSON),
+	}
+	if log.Changes, err = AuditChanges(log.Before, log.After); err != nil {
+		return err
+	}
+	// LOCALTIMESTAMP is fixed for the whole transaction, so the value hashed
+	// here is exactly the one stored by the INSERT below.
+	sql := `
+	SELECT
+		head.seq,
+		head.hash,
+		LOCALTIMESTAMP
+	FROM
+		(
+			SELECT seq, hash FROM audit_logs
+			UNION ALL
+			SELECT seq, hash FROM audit_checkpoints
+			UNION ALL
+			SELECT 0, ''
+		) AS head
+	ORDER BY
+		head.seq DESC
+	LIMIT 1
+	`
+	if err := q.QueryRowContext(ctx, sql).Scan(&log.Seq, &log.PrevHash, &log.CreatedAt); err != nil {
+		return err
+	}
+	log.Seq++
+	if log.Hash, err = AuditHash(log.PrevHash, log); err != nil {
+		return err
+	}
+
+	sql = "INSERT INTO audit_logs (seq, actor, action, entity, entity_id, app_id, before, after, changes, created_at, prev_hash, hash) VALUES ($1, $2, $3, $4, $5, $6, $7::jsonb, $8::jsonb, $9::jsonb, LOCALTIMESTAMP, $10, $11)"
+	_, err = q.ExecContext(ctx, sql, log.Seq, log.Actor, log.Action, log.Entity, log.EntityID, log.AppID, beforeJSON, afterJSON, string(log.Changes), log.PrevHash, log.Hash)
+	return err
+}
+
+func rawJSON(v interface{}) json.RawMessage {
+	if s, ok := v.(string); ok {
+		return json.RawMessage(s)
+	}
+	return nil
+}
+
+// auditJSON encodes a snapshot for a JSONB column, mapping nil snapshots
+// (including typed nil pointers) to SQL NULL.
+func auditJSON(v interface{}) (interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if string(b) == "null" {
+		return nil, nil
+	}
+	return string(b), nil
+}
+
+// auditList pages audit logs by seq alone, which is unique.
+var auditList = listSpec{
+	table:       "audit_logs",
+	sorts:       []string{"seq"},
+	defaultSort: "-seq",
+	fields: filter.Fields{
+		"seq":        {Column: "seq", Kind: filter.Int},
+		"actor":      {Column: "actor"},
+		"action":     {Column: "action"},
+		"entity":     {Column: "entity"},
+		"entity_id":  {Column: "entity_id"},
+		"app_id":     {Column: "app_id"},
+		"created_at": {Column: "created_at", Kind: filter.Time},
+	},
+}
+
+// auditLogsQuery selects the entries matching opts, newest first unless
+// opts.Sort is "seq".
+func auditLogsQuery(opts *ListOptions) (string, []interface{}, *listPage, error) {
+	if opts == nil {
+		opts = &ListOptions{}
+	}
+	page, err := parsePage(opts, auditList)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	where, vals, err := compileFilter(opts.Filter, auditList.fields)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	if cond, after := page.cond(auditList.table); cond != "" {
+		where = "(" + where + ") AND " + cond
+		vals = append(vals, after...)
+	}
+	sql := `
+	SELECT
+		id,
+		seq,
+		actor,
+		action,
+		entity,
+		entity_id,
+		app_id,
+		before,
+		after,
+		changes,
+		created_at,
+		prev_hash,
+		hash
+	FROM
+		audit_logs
+	WHERE
+		` + where + page.orderBy(auditList.table) + page.limitSQL()
+	return sqlx.Rebind(sqlx.DOLLAR, sql), vals, page, nil
+}
+
+func scanAuditLog(rows interface{ Scan(...interface{}) error }) (*model.AuditLog, error) {
+	var log model.AuditLog
+	var before, after, changes []byte
+	if err := rows.Scan(&log.ID, &log.Seq, &log.Actor, &log.Action, &log.Entity, &log.EntityID, &log.AppID, &before, &after, &changes, &log.CreatedAt, &log.PrevHash, &log.Hash); err != nil {
+		return nil, err
+	}
+	log.Before = json.RawMessage(before)
+	log.After = json.RawMessage(after)
+	log.Changes = json.RawMessage(changes)
+	return &log, nil
+}
+
+func (service *service) GetAuditLogs(ctx context.Context, opts *ListOptions) ([]*model.AuditLog, string, error) {
+	sql, vals, page, err := auditLogsQuery(opts)
+	if err != nil {
+		return nil, "", err
+	}
+	logs := make([]*model.AuditLog, 0)
+	err = service.queryAuditLogs(ctx, sql, vals, func(log *model.AuditLog) error {
+		logs = append(logs, log)
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	n, next := page.next(len(logs), func(i int, column string) interface{} {
+		return logs[i].Seq
+	})
+	return logs[:n], next, nil
+}
+
+// ExportAuditLogs streams every matching entry to fn without buffering the
+// result set, so exports are not bounded by memory.
+func (service *service) ExportAuditLogs(ctx context.Context, opts *ListOptions, fn func(*model.AuditLog) error) error {
+	sql, vals, _, err := auditLogsQuery(opts)
+	if err != nil {
+		return err
+	}
+	return service.queryAuditLogs(ctx, sql, vals, fn)
+}
+
+func (service *service) queryAuditLogs(ctx context.Context, sql string, vals []interface{}, fn func(*model.AuditLog) error) error {
+	rows, err := service.db.QueryContext(ctx, sql, vals...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		log, err := scanAuditLog(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(log); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (service *service) auditCheckpoint(ctx context.Context, q querier) (int64, string, error) {
+	var seq int64
+	var hash string
+	sql := "SELECT seq, hash FROM audit_checkpoints ORDER BY seq DESC LIMIT 1"
+	err := q.QueryRowContext(ctx, sql).Scan(&seq, &hash)
+	if errors.Is(err, dbsql.ErrNoRows) {
+		return 0, "", nil
+	}
+	return seq, hash, err
+}
+
+// VerifyAuditLogs walks the chain from the most recent retention checkpoint
+// to the newest entry.
+func (service *service) VerifyAuditLogs(ctx context.Context) (*model.AuditVerification, error) {
+	seq, hash, err := service.auditCheckpoint(ctx, service.db)
+	if err != nil {
+		return nil, err
+	}
+	verifier := NewAuditVerifier(seq, hash)
+
+	sql := `
+	SELECT
+		id, seq, actor, action, entity, entity_id, app_id, before, after, changes, created_at, prev_hash, hash
+	FROM
+		audit_logs
+	WHERE
+		seq > $1
+	ORDER BY
+		seq
+	`
+	rows, err := service.db.QueryContext(ctx, sql, seq)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		log, err := scanAuditLog(rows)
+		if err != nil {
+			return nil, err
+		}
+		if err := verifier.Add(log); err != nil {
+			return nil, err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return verifier.Result(), nil
+}
+
+// ArchiveAuditLogs moves every entry older than retention into a gzipped
+// NDJSON file in dir and prunes it from the table. The archive is durable on
+// disk before the delete commits, and a checkpoint keeps the remaining chain
+// verifiable. A nil archive means there was nothing to prune.
+func (service *service) ArchiveAuditLogs(ctx context.Context, retention time.Duration, dir string) (*model.AuditArchive, error) {
+	var archive *model.AuditArchive
+	err := service.withTx(ctx, func(tx *dbsql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext('audit_logs'))"); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "SET LOCAL guardian.audit_prune = 'on'"); err != nil {
+			return err
+		}
+
+		// Only a prefix of the chain may be pruned, so the range ends at the
+		// newest expired entry rather than filtering on created_at directly.
+		// The cutoff is taken from the database clock, which also stamps
+		// created_at.
+		sql := `
+		SELECT
+			id, seq, actor, action, entity, entity_id, app_id, before, after, changes, created_at, prev_hash, hash
+		FROM
+			audit_logs
+		WHERE
+			seq <= (SELECT MAX(seq) FROM audit_logs WHERE created_at < LOCALTIMESTAMP - make_interval(secs => $1))
+		ORDER BY
+			seq
+		`
+		rows, err := tx.QueryContext(ctx, sql, retention.Seconds())
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		tmp, err := os.CreateTemp(dir, "audit-*.ndjson.gz.tmp")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+
+		gz := gzip.NewWriter(tmp)
+		var first, last *model.AuditLog
+		var count int64
+		for rows.Next() {
+			log, err := scanAuditLog(rows)
+			if err != nil {
+				return err
+			}
+			if err := WriteAuditRecord(gz, log); err != nil {
+				return err
+			}
+			if first == nil {
+				first = log
+			}
+			last = log
+			count++
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		rows.Close()
+		if count == 0 {
+			return nil
+		}
+		if err := gz.Close(); err != nil {
+			return err
+		}
+		if err := tmp.Sync(); err != nil {
+			return err
+		}
+		if err := tmp.Close(); err != nil {
+			return err
+		}
+
+		name := filepath.Join(dir, fmt.Sprintf("audit-%020d-%020d.ndjson.gz", first.Seq, last.Seq))
+		if err := os.Rename(tmp.Name(), name); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, "DELETE FROM audit_logs WHERE seq <= $1", last.Seq); err != nil {
+			os.Remove(name)
+			return err
+		}
+		sql = "INSERT INTO audit_checkpoints (seq, hash, archive) VALUES ($1, $2, $3)"
+		if _, err := tx.ExecContext(ctx, sql, last.Seq, last.Hash, filepath.Base(name)); err != nil {
+			os.Remove(name)
+			return err
+		}
+
+		archive = &model.AuditArchive{File: name, FirstSeq: first.Seq, LastSeq: last.Seq, Count: count}
+		return nil
+	})
+	if err != nil {
+		if archive != nil {
+			os.Remove(archive.File)
+		}
+		return nil, err
+	}
+	return archive, nil
+}
@@ -0,0 +1,183 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"guardian/internal/casbin"
+	"guardian/internal/model"
+	"guardian/internal/validation"
+)
+
+// ImportCasbin adds the role permissions and user assignments of Casbin
+// policy rules, in one transaction. Permissions, roles and users a rule
+// refers to are created as needed, named after their IDs, but applications
+// are not: rules for an unknown application, or with identifiers Guardian
+// does not accept, are reported as unmapped and skipped. Nothing is removed.
+func (service *service) ImportCasbin(ctx context.Context, rules []*model.CasbinRule) (*model.CasbinImport, error) {
+	ctx = withoutExpectedVersion(ctx)
+	result := &model.CasbinImport{
+		Created:  make([]*model.ChangeRef, 0),
+		Unmapped: make([]*model.UnmappedLine, 0),
+	}
+	unmap := func(rule *model.CasbinRule, reason string) {
+		result.Unmapped = append(result.Unmapped, &model.UnmappedLine{Line: rule.Line, Text: casbin.Text(rule), Reason: reason})
+	}
+	created := func(entity string, id string) {
+		result.Created = append(result.Created, &model.ChangeRef{Entity: entity, ID: id})
+	}
+
+	err := service.withTx(ctx, func(tx *sql.Tx) error {
+		ctx := context.WithValue(ctx, txKey{}, tx)
+
+		// Map every rule first, so that entities are created in one pass
+		// and in the order the policy first mentions them.
+		apps := make(map[string]bool)
+		var perms []*model.Permission
+		var roles []*model.Role
+		var grants [][3]string
+		seenPerm := make(map[[2]string]bool)
+		roleIndex := make(map[[2]string]*model.Role)
+		seenGrant := make(map[[3]string]bool)
+		for _, rule := range rules {
+			exists, ok := apps[rule.Domain]
+			if !ok {
+				app, err := service.findApp(ctx, tx, rule.Domain)
+				if err != nil {
+					return err
+				}
+				exists = app != nil
+				apps[rule.Domain] = exists
+			}
+			if !exists {
+				unmap(rule, describe(model.EntityApplication, rule.Domain, "")+" does not exist")
+				continue
+			}
+
+			roleID := rule.Subject
+			if rule.PType == "g" {
+				roleID = rule.Object
+			}
+			role := &model.Role{ID: roleID, AppID: rule.Domain, Name: roleID}
+			if err := validation.Role(role); err != nil {
+				unmap(rule, err.Error())
+				continue
+			}
+			var perm *model.Permission
+			if rule.PType == "p" {
+				perm = &model.Permission{ID: rule.Object, AppID: rule.Domain, Name: rule.Object}
+				if err := validation.Permission(perm); err != nil {
+					unmap(rule, err.Error())
+					continue
+				}
+			} else if err := validation.User(&model.User{UserName: rule.Subject}); err != nil {
+				unmap(rule, err.Error())
+				continue
+			}
+
+			result.Lines++
+			roleKey := [2]string{role.AppID, role.ID}
+			if roleIndex[roleKey] == nil {
+				role.Permissions = make([]*model.Permission, 0)
+				roleIndex[roleKey] = role
+				roles = append(roles, role)
+			}
+			if perm != nil {
+				if permKey := [2]string{perm.AppID, perm.ID}; !seenPerm[permKey] {
+					seenPerm[permKey] = true
+					perms = append(perms, perm)
+				}
+				roleIndex[roleKey].Permissions = append(roleIndex[roleKey].Permissions, perm)
+				continue
+			}
+			if grant := [3]string{rule.Subject, role.ID, role.AppID}; !seenGrant[grant] {
+				seenGrant[grant] = true
+				grants = append(grants, grant)
+			}
+		}
+
+		for _, perm := range perms {
+			before, err := service.findPerm(ctx, tx, perm.ID, perm.AppID)
+			if err != nil {
+				return err
+			}
+			if before != nil {
+				continue
+			}
+			if err := service.writePerm(ctx, perm, writeUpsert); err != nil {
+				return err
+			}
+			created(model.EntityPermission, perm.ID)
+		}
+
+		for _, role := range roles {
+			role.Permissions = uniquePermissions(role.Permissions)
+			before, err := service.findRole(ctx, tx, role.ID, role.AppID)
+			if err != nil {
+				return err
+			}
+			if before == nil {
+				if err := service.writeRole(ctx, tx, role, writeUpsert, ""); err != nil {
+					return err
+				}
+				created(model.EntityRole, role.ID)
+				result.Attached += len(role.Permissions)
+				continue
+			}
+			if len(role.Permissions) == 0 {
+				continue
+			}
+			delta := &model.RolePermissionDelta{Add: make([]string, 0, len(role.Permissions))}
+			for _, perm := range role.Permissions {
+				delta.Add = append(delta.Add, perm.ID)
+			}
+			changes, err := service.UpdateRolePermissions(ctx, role.ID, role.AppID, delta)
+			if err != nil {
+				return err
+			}
+			result.Attached += len(changes.Added)
+		}
+
+		users := make(map[string]bool)
+		for _, grant := range grants {
+			userName := grant[0]
+			if !users[userName] {
+				users[userName] = true
+				before, err := service.findUser(ctx, tx, userName)
+				if err != nil {
+					return err
+				}
+				if before == nil {
+					if err := service.writeUser(ctx, &model.User{UserName: userName, Roles: make([]*model.Role, 0)}, writeUpsert); err != nil {
+						return err
+					}
+					created(model.EntityUser, userName)
+				}
+			}
+			changed, err := service.GrantUserRole(ctx, userName, grant[1], grant[2])
+			if err != nil {
+				return err
+			}
+			if changed {
+				result.Granted++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// uniquePermissions drops repeated permission IDs, keeping the first.
+func uniquePermissions(perms []*model.Permission) []*model.Permission {
+	seen := make(map[string]bool, len(perms))
+	unique := make([]*model.Permission, 0, len(perms))
+	for _, perm := range perms {
+		if !seen[perm.ID] {
+			seen[perm.ID] = true
+			unique = append(unique, perm)
+		}
+	}
+	return unique
+}
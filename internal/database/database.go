@@ -4,12 +4,13 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"guardian/internal/filter"
 	"guardian/internal/model"
+	"guardian/internal/validation"
 	"log"
 	"os"
-	"strings"
-	"sync"
 	"time"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
@@ -19,253 +20,494 @@ import (
 
 type Service interface {
 	Health() map[string]string
-	GetApps(ctx context.Context) ([]*model.Application, error)
-	GetPerms(ctx context.Context) ([]*model.Permission, error)
-	GetUsers(ctx context.Context) ([]*model.User, error)
-	GetRoles(ctx context.Context, args *sync.Map) ([]*model.Role, error)
+	GetApps(ctx context.Context, opts *ListOptions) ([]*model.Application, string, error)
+	GetPerms(ctx context.Context, opts *ListOptions) ([]*model.Permission, string, error)
+	GetUsers(ctx context.Context, opts *ListOptions, view *UserView) ([]*model.User, string, error)
+	GetRoles(ctx context.Context, opts *ListOptions) ([]*model.Role, string, error)
 	GetApp(ctx context.Context, appID string) (*model.Application, error)
 	GetPerm(ctx context.Context, permID string, appID string) (*model.Permission, error)
-	GetUser(ctx context.Context, userName string) (*model.User, error)
+	GetUser(ctx context.Context, userName string, view *UserView) (*model.User, error)
 	GetRole(ctx context.Context, roleID string, appID string) (*model.Role, error)
 	UpsertApp(ctx context.Context, app *model.Application) error
 	UpsertPerm(ctx context.Context, perm *model.Permission) error
 	UpsertUser(ctx context.Context, user *model.User) error
 	UpsertRole(ctx context.Context, role *model.Role) error
+	CreateApp(ctx context.Context, app *model.Application) error
+	CreatePerm(ctx context.Context, perm *model.Permission) error
+	CreateUser(ctx context.Context, user *model.User) error
+	CreateRole(ctx context.Context, role *model.Role) error
+	ReplaceApp(ctx context.Context, app *model.Application) error
+	ReplacePerm(ctx context.Context, perm *model.Permission) error
+	ReplaceUser(ctx context.Context, user *model.User) error
+	ReplaceRole(ctx context.Context, role *model.Role) error
+	ExportManifest(ctx context.Context, appID string) (*model.Manifest, error)
+	ImportManifest(ctx context.Context, manifest *model.Manifest) (*model.ManifestResult, error)
+	PlanManifest(ctx context.Context, manifest *model.Manifest, prune bool) (*model.Plan, error)
+	ApplyManifest(ctx context.Context, manifest *model.Manifest, prune bool) (*model.Plan, error)
+	DetectDrift(ctx context.Context, appID string) ([]*model.Drift, error)
+	ExportBundle(ctx context.Context, appID string) (*model.Bundle, error)
+	DiffBundle(ctx context.Context, bundle *model.Bundle) (*model.PromotionDiff, error)
+	Promote(ctx context.Context, promotion *model.Promotion) (*model.PromotionResult, error)
+	ExportAssignments(ctx context.Context, appID string, fn func(*model.Assignment) error) error
+	ImportAssignments(ctx context.Context, mode string, appID string, next func() (*model.AssignmentRow, error)) (*model.AssignmentImport, error)
+	ImportCasbin(ctx context.Context, rules []*model.CasbinRule) (*model.CasbinImport, error)
+	OPAData(ctx context.Context) (*model.OPAData, error)
+	OPARevision(ctx context.Context) (string, error)
+	ImportKeycloak(ctx context.Context, imp *model.KeycloakImport) error
 	DeleteApp(ctx context.Context, appID string) error
 	DeletePerm(ctx context.Context, permID string, appID string) error
 	DeleteUser(ctx context.Context, userName string) error
 	DeleteRole(ctx context.Context, roleID string, appID string) error
+	GetRoleMembers(ctx context.Context, roleID string, appID string, opts *ListOptions) ([]*model.RoleMember, string, error)
+	CountRoleMembers(ctx context.Context, roleID string, appID string, opts *ListOptions) (int, error)
+	Search(ctx context.Context, query string, limit int) (*model.SearchResults, error)
+	GetAuditLogs(ctx context.Context, opts *ListOptions) ([]*model.AuditLog, string, error)
+	ExportAuditLogs(ctx context.Context, opts *ListOptions, fn func(*model.AuditLog) error) error
+	VerifyAuditLogs(ctx context.Context) (*model.AuditVerification, error)
+	ArchiveAuditLogs(ctx context.Context, retention time.Duration, dir string) (*model.AuditArchive, error)
+	GetRoleVersions(ctx context.Context, roleID string, appID string) ([]*model.RoleVersion, error)
+	GetRoleVersion(ctx context.Context, roleID string, appID string, version int) (*model.RoleVersion, error)
+	DiffRoleVersions(ctx context.Context, roleID string, appID string, from int, to int) (*model.RoleVersionDiff, error)
+	RollbackRole(ctx context.Context, roleID string, appID string, version int) (*model.Role, error)
+	GetUserAsOf(ctx context.Context, userName string, asOf time.Time) (*model.User, error)
+	GetRoleAsOf(ctx context.Context, roleID string, appID string, asOf time.Time) (*model.Role, error)
+	GetEffectivePermissions(ctx context.Context, userName string, appID string, asOf *time.Time) ([]*model.EffectivePermission, error)
+	RestoreApp(ctx context.Context, appID string) error
+	RestorePerm(ctx context.Context, permID string, appID string) error
+	RestoreRole(ctx context.Context, roleID string, appID string) error
+	RestoreUser(ctx context.Context, userName string) error
+	PurgeDeleted(ctx context.Context, retention time.Duration) (*model.PurgeResult, error)
+	DryRun(ctx context.Context, fn func(ctx context.Context) error) (*model.ChangeSummary, error)
+	GrantUserRole(ctx context.Context, userName string, roleID string, appID string) (bool, error)
+	RevokeUserRole(ctx context.Context, userName string, roleID string, appID string) (bool, error)
+	AttachRolePermission(ctx context.Context, roleID string, appID string, permID string) (bool, error)
+	DetachRolePermission(ctx context.Context, roleID string, appID string, permID string) (bool, error)
+	UpdateRolePermissions(ctx context.Context, roleID string, appID string, delta *model.RolePermissionDelta) (*model.RolePermissionChanges, error)
 }
 
 type service struct {
 	db *sql.DB
 }
 
-func (service *service) GetApps(ctx context.Context) ([]*model.Application, error) {
-	sql := "SELECT * FROM applications"
-	rows, err := service.db.QueryContext(ctx, sql)
+// querier is satisfied by both *sql.DB and *sql.Tx so that reads can be
+// shared between plain lookups and the snapshots taken inside a write.
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// withTx runs fn in a new transaction, or in the transaction already carried
+// by ctx (see DryRun), in which case committing is left to its owner.
+func (service *service) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return translate(fn(tx))
+	}
+
+	tx, err := service.db.BeginTx(ctx, nil)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return translate(err)
+	}
+	return translate(tx.Commit())
+}
+
+var (
+	appList = listSpec{
+		table:       "applications",
+		keys:        []string{"id"},
+		sorts:       []string{"id", "name", "created_at"},
+		defaultSort: "id",
+		fields: filter.Fields{
+			"id":          {Column: "applications.id"},
+			"name":        {Column: "applications.name"},
+			"description": {Column: "applications.description"},
+			"created_at":  {Column: "applications.created_at", Kind: filter.Time},
+			"version":     {Column: "applications.version", Kind: filter.Int},
+		},
+	}
+	permList = listSpec{
+		table:       "permissions",
+		keys:        []string{"app_id", "id"},
+		sorts:       []string{"id", "name", "created_at"},
+		defaultSort: "id",
+		fields: filter.Fields{
+			"id":          {Column: "permissions.id"},
+			"app_id":      {Column: "permissions.app_id"},
+			"name":        {Column: "permissions.name"},
+			"description": {Column: "permissions.description"},
+			"created_at":  {Column: "permissions.created_at", Kind: filter.Time},
+			"version":     {Column: "permissions.version", Kind: filter.Int},
+			"role_id": {
+				Column: "roles.id",
+				Exists: `SELECT 1 FROM role_permissions
+					JOIN roles ON roles.id = role_permissions.role_id AND roles.app_id = role_permissions.app_id AND roles.deleted_at IS NULL
+					WHERE role_permissions.permission_id = permissions.id AND role_permissions.app_id = permissions.app_id AND`,
+			},
+		},
+	}
+	roleList = listSpec{
+		table:       "roles",
+		keys:        []string{"app_id", "id"},
+		sorts:       []string{"id", "name", "created_at"},
+		defaultSort: "id",
+		fields: filter.Fields{
+			"id":          {Column: "roles.id"},
+			"app_id":      {Column: "roles.app_id"},
+			"name":        {Column: "roles.name"},
+			"description": {Column: "roles.description"},
+			"created_at":  {Column: "roles.created_at", Kind: filter.Time},
+			"version":     {Column: "roles.version", Kind: filter.Int},
+			"permission_id": {
+				Column: "permissions.id",
+				Exists: `SELECT 1 FROM role_permissions
+					JOIN permissions ON permissions.id = role_permissions.permission_id AND permissions.app_id = role_permissions.app_id AND permissions.deleted_at IS NULL
+					WHERE role_permissions.role_id = roles.id AND role_permissions.app_id = roles.app_id AND`,
+			},
+		},
+	}
+	userList = listSpec{
+		table:       "users",
+		keys:        []string{"username"},
+		sorts:       []string{"username", "created_at", "updated_at"},
+		defaultSort: "-updated_at",
+		fields: filter.Fields{
+			"username":   {Column: "users.username"},
+			"created_at": {Column: "users.created_at", Kind: filter.Time},
+			"updated_at": {Column: "users.updated_at", Kind: filter.Time},
+			"version":    {Column: "users.version", Kind: filter.Int},
+			"app_id":     {Column: "roles.app_id", Exists: userRolesExists},
+			"role_id":    {Column: "roles.id", Exists: userRolesExists},
+		},
+	}
+)
+
+// userRolesExists selects the visible roles of a user, for filters on them.
+const userRolesExists = `SELECT 1 FROM user_roles
+	JOIN roles ON roles.id = user_roles.role_id AND roles.app_id = user_roles.app_id AND roles.deleted_at IS NULL
+	WHERE user_roles.username = users.username AND`
+
+func (service *service) GetApps(ctx context.Context, opts *ListOptions) ([]*model.Application, string, error) {
+	if opts == nil {
+		opts = &ListOptions{}
+	}
+	page, err := parsePage(opts, appList)
+	if err != nil {
+		return nil, "", err
+	}
+	where, vals, err := listWhere(opts, appList, page)
+	if err != nil {
+		return nil, "", err
+	}
+
+	sql := "SELECT id, name, description, created_at, version FROM applications WHERE " + where + page.orderBy("applications") + page.limitSQL()
+	rows, err := service.db.QueryContext(ctx, sqlx.Rebind(sqlx.DOLLAR, sql), vals...)
+	if err != nil {
+		return nil, "", err
 	}
 	defer rows.Close()
 	apps := make([]*model.Application, 0)
 	for rows.Next() {
 		var app model.Application
-		if err := rows.Scan(&app.ID, &app.Name, &app.Description); err != nil {
-			return nil, err
+		if err := rows.Scan(&app.ID, &app.Name, &app.Description, &app.CreatedAt, &app.Version); err != nil {
+			return nil, "", err
 		}
 		apps = append(apps, &app)
 	}
-	return apps, nil
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	n, next := page.next(len(apps), func(i int, column string) interface{} {
+		switch column {
+		case "name":
+			return apps[i].Name
+		case "created_at":
+			return apps[i].CreatedAt
+		}
+		return apps[i].ID
+	})
+	return apps[:n], next, nil
+}
+
+func (service *service) GetPerms(ctx context.Context, opts *ListOptions) ([]*model.Permission, string, error) {
+	return service.getPerms(ctx, service.db, opts)
 }
 
-func (service *service) GetPerms(ctx context.Context) ([]*model.Permission, error) {
-	sql := "SELECT * FROM permissions"
-	rows, err := service.db.QueryContext(ctx, sql)
+func (service *service) getPerms(ctx context.Context, q querier, opts *ListOptions) ([]*model.Permission, string, error) {
+	if opts == nil {
+		opts = &ListOptions{}
+	}
+	page, err := parsePage(opts, permList)
+	if err != nil {
+		return nil, "", err
+	}
+	where, vals, err := listWhere(opts, permList, page)
+	if err != nil {
+		return nil, "", err
+	}
+
+	sql := "SELECT id, app_id, name, description, created_at, version FROM permissions WHERE " + where + page.orderBy("permissions") + page.limitSQL()
+	rows, err := q.QueryContext(ctx, sqlx.Rebind(sqlx.DOLLAR, sql), vals...)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	defer rows.Close()
 	perms := make([]*model.Permission, 0)
 	for rows.Next() {
 		var perm model.Permission
-		if err := rows.Scan(&perm.ID, &perm.AppID, &perm.Name, &perm.Description, &perm.CreatedAt); err != nil {
-			return nil, err
+		if err := rows.Scan(&perm.ID, &perm.AppID, &perm.Name, &perm.Description, &perm.CreatedAt, &perm.Version); err != nil {
+			return nil, "", err
 		}
 		perms = append(perms, &perm)
 	}
-	return perms, nil
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	n, next := page.next(len(perms), func(i int, column string) interface{} {
+		switch column {
+		case "app_id":
+			return perms[i].AppID
+		case "name":
+			return perms[i].Name
+		case "created_at":
+			return perms[i].CreatedAt
+		}
+		return perms[i].ID
+	})
+	return perms[:n], next, nil
 }
 
-func (service *service) GetUsers(ctx context.Context) ([]*model.User, error) {
-	sql := `
-	SELECT 
-		users.username, 
-		users.created_at, 
-		users.updated_at,
-	json_agg(json_build_object('id', roles.id, 'app_id', roles.app_id, 'name', roles.name, 'description', roles.description, 'created_at', roles.created_at::text, 'permissions', roles.permissions)) AS roles
-	FROM 
-		users 
-	LEFT JOIN 
-		user_roles 
-	ON 
-		users.username = user_roles.username 
-	LEFT JOIN
-		(
-			SELECT
-				roles.id,
-				roles.app_id,
-				roles.name,
-				roles.description,
-				roles.created_at,
-	json_agg(json_build_object('id', permissions.id, 'app_id', permissions.app_id, 'name', permissions.name, 'description', permissions.description,'created_at', permissions.created_at::text)) AS permissions
-			FROM
-				roles
-			JOIN
-				role_permissions ON roles.id = role_permissions.role_id AND roles.app_id = role_permissions.app_id
-			JOIN
-				permissions ON permissions.id = role_permissions.permission_id AND permissions.app_id = role_permissions.app_id
-			GROUP BY
-				roles.id, roles.app_id, roles.name, roles.description, roles.created_at
-		) AS roles 
-	ON 
-		user_roles.role_id = roles.id AND user_roles.app_id = roles.app_id
-	GROUP BY
-		users.username , users.created_at , users.updated_at
-	ORDER BY
-		users.updated_at DESC , users.username
-	`
-	rows, err := service.db.QueryContext(ctx, sql)
+// GetUsers pages through users before aggregating their roles, so the cost
+// of a page does not grow with the number of users.
+func (service *service) GetUsers(ctx context.Context, opts *ListOptions, view *UserView) ([]*model.User, string, error) {
+	if opts == nil {
+		opts = &ListOptions{}
+	}
+	if err := view.validate(); err != nil {
+		return nil, "", err
+	}
+	page, err := parsePage(opts, userList)
 	if err != nil {
-		return nil, err
+		return nil, "", err
+	}
+	where, vals, err := listWhere(opts, userList, page)
+	if err != nil {
+		return nil, "", err
+	}
+
+	sql := fmt.Sprintf(`
+	WITH page AS (
+		SELECT users.username, users.created_at, users.updated_at, users.version
+		FROM users
+		WHERE %s
+		%s
+		%s
+	)
+	%s
+	%s
+	`,
+		where,
+		page.orderBy("users"),
+		page.limitSQL(),
+		usersSQL(view),
+		page.orderBy("page"),
+	)
+	rows, err := service.db.QueryContext(ctx, sqlx.Rebind(sqlx.DOLLAR, sql), vals...)
+	if err != nil {
+		return nil, "", err
 	}
 	defer rows.Close()
 	users := make([]*model.User, 0)
 	for rows.Next() {
-		var user model.User
-		user.Roles = make([]*model.Role, 0)
-		var roles string
-		if err := rows.Scan(&user.UserName, &user.CreatedAt, &user.UpdatedAt, &roles); err != nil {
-			return nil, err
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, "", err
 		}
-		user.Roles = make([]*model.Role, 0)
-		if err := json.Unmarshal([]byte(roles), &user.Roles); err != nil {
-			return nil, err
-		}
-		users = append(users, &user)
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
 	}
-	return users, nil
+
+	n, next := page.next(len(users), func(i int, column string) interface{} {
+		switch column {
+		case "created_at":
+			return users[i].CreatedAt
+		case "updated_at":
+			return users[i].UpdatedAt
+		}
+		return users[i].UserName
+	})
+	return users[:n], next, nil
 }
 
-func (service *service) GetRoles(ctx context.Context, args *sync.Map) ([]*model.Role, error) {
-	var conds []string
-	var vals []interface{}
-	if args == nil {
-		args = &sync.Map{}
+func (service *service) GetRoles(ctx context.Context, opts *ListOptions) ([]*model.Role, string, error) {
+	return service.getRoles(ctx, service.db, opts)
+}
+
+func (service *service) getRoles(ctx context.Context, q querier, opts *ListOptions) ([]*model.Role, string, error) {
+	if opts == nil {
+		opts = &ListOptions{}
 	}
-	if v, ok := args.Load("app_id"); ok {
-		conds = append(conds, "roles.app_id = ?")
-		vals = append(vals, v)
+	page, err := parsePage(opts, roleList)
+	if err != nil {
+		return nil, "", err
 	}
-
-	var where string
-	if len(conds) > 0 {
-		where = " WHERE " + strings.Join(conds, " AND ")
+	where, vals, err := listWhere(opts, roleList, page)
+	if err != nil {
+		return nil, "", err
 	}
+
 	sql := fmt.Sprintf(`
+	WITH page AS (
+		SELECT roles.id, roles.app_id, roles.name, roles.description, roles.created_at, roles.version
+		FROM roles
+		WHERE %s
+		%s
+		%s
+	)
 	SELECT 
-		roles.id,
-		roles.app_id,
-		roles.name,
-		roles.description,
-		roles.created_at,
-	json_agg(json_build_object('id', permissions.id, 'app_id', permissions.app_id, 'name', permissions.name, 'description', permissions.description, 'created_at' , permissions.created_at::text)) AS permissions
+		page.id,
+		page.app_id,
+		page.name,
+		page.description,
+		page.created_at,
+		page.version,
+	COALESCE(json_agg(json_build_object('id', permissions.id, 'app_id', permissions.app_id, 'name', permissions.name, 'description', permissions.description, 'created_at' , permissions.created_at::text)) FILTER (WHERE permissions.id IS NOT NULL), '[]') AS permissions
 	FROM 
-		roles
-	JOIN
-		role_permissions ON roles.id = role_permissions.role_id AND roles.app_id = role_permissions.app_id
-	JOIN
-		permissions ON permissions.id = role_permissions.permission_id AND permissions.app_id = role_permissions.app_id
-	%s
+		page
+	LEFT JOIN
+		role_permissions ON page.id = role_permissions.role_id AND page.app_id = role_permissions.app_id
+	LEFT JOIN
+		permissions ON permissions.id = role_permissions.permission_id AND permissions.app_id = role_permissions.app_id AND permissions.deleted_at IS NULL
 	GROUP BY
-		roles.id, roles.app_id, roles.name, roles.description, roles.created_at
+		page.id, page.app_id, page.name, page.description, page.created_at, page.version
+	%s
 	`,
 		where,
+		page.orderBy("roles"),
+		page.limitSQL(),
+		page.orderBy("page"),
 	)
-	sql = sqlx.Rebind(sqlx.DOLLAR, sql)
-	rows, err := service.db.QueryContext(ctx, sql, vals...)
+	rows, err := q.QueryContext(ctx, sqlx.Rebind(sqlx.DOLLAR, sql), vals...)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	defer rows.Close()
 	roles := make([]*model.Role, 0)
 	for rows.Next() {
 		var role model.Role
 		var perms string
-		if err := rows.Scan(&role.ID, &role.AppID, &role.Name, &role.Description, &role.CreatedAt, &perms); err != nil {
-			return nil, err
+		if err := rows.Scan(&role.ID, &role.AppID, &role.Name, &role.Description, &role.CreatedAt, &role.Version, &perms); err != nil {
+			return nil, "", err
 		}
 		role.Permissions = make([]*model.Permission, 0)
 		if err := json.Unmarshal([]byte(perms), &role.Permissions); err != nil {
-			return nil, err
+			return nil, "", err
 		}
 		roles = append(roles, &role)
 	}
-	return roles, nil
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	n, next := page.next(len(roles), func(i int, column string) interface{} {
+		switch column {
+		case "app_id":
+			return roles[i].AppID
+		case "name":
+			return roles[i].Name
+		case "created_at":
+			return roles[i].CreatedAt
+		}
+		return roles[i].ID
+	})
+	return roles[:n], next, nil
 }
 
 func (service *service) GetApp(ctx context.Context, appID string) (*model.Application, error) {
-	sql := "SELECT * FROM applications WHERE id = $1"
-	row := service.db.QueryRowContext(ctx, sql, appID)
+	app, err := service.getApp(ctx, service.db, appID)
+	return app, notFoundAs(err, model.EntityApplication, appID, "")
+}
+
+func (service *service) getApp(ctx context.Context, q querier, appID string) (*model.Application, error) {
+	sql := "SELECT id, name, description, created_at, version FROM applications WHERE id = $1 AND deleted_at IS NULL"
+	row := q.QueryRowContext(ctx, sql, appID)
 	var app model.Application
-	if err := row.Scan(&app.ID, &app.Name, &app.Description); err != nil {
+	if err := row.Scan(&app.ID, &app.Name, &app.Description, &app.CreatedAt, &app.Version); err != nil {
 		return nil, err
 	}
 	return &app, nil
 }
 
 func (service *service) GetPerm(ctx context.Context, permID string, appID string) (*model.Permission, error) {
-	sql := "SELECT * FROM permissions WHERE id = $1 AND app_id = $2"
-	row := service.db.QueryRowContext(ctx, sql, permID, appID)
+	perm, err := service.getPerm(ctx, service.db, permID, appID)
+	return perm, notFoundAs(err, model.EntityPermission, permID, appID)
+}
+
+func (service *service) getPerm(ctx context.Context, q querier, permID string, appID string) (*model.Permission, error) {
+	sql := "SELECT id, app_id, name, description, created_at, version FROM permissions WHERE id = $1 AND app_id = $2 AND deleted_at IS NULL"
+	row := q.QueryRowContext(ctx, sql, permID, appID)
 	var perm model.Permission
-	if err := row.Scan(&perm.ID, &perm.AppID, &perm.Name, &perm.Description, &perm.CreatedAt); err != nil {
+	if err := row.Scan(&perm.ID, &perm.AppID, &perm.Name, &perm.Description, &perm.CreatedAt, &perm.Version); err != nil {
 		return nil, err
 	}
 	return &perm, nil
 }
 
-func (service *service) GetUser(ctx context.Context, userName string) (*model.User, error) {
+func (service *service) GetUser(ctx context.Context, userName string, view *UserView) (*model.User, error) {
+	if err := view.validate(); err != nil {
+		return nil, err
+	}
+	user, err := service.queryUser(ctx, service.db, userName, view)
+	return user, notFoundAs(err, model.EntityUser, userName, "")
+}
+
+func (service *service) getUser(ctx context.Context, q querier, userName string) (*model.User, error) {
+	return service.queryUser(ctx, q, userName, nil)
+}
+
+func (service *service) queryUser(ctx context.Context, q querier, userName string, view *UserView) (*model.User, error) {
 	sql := `
-	SELECT 
-		users.username, 
-		users.created_at, 
-		users.updated_at,
-	json_agg(json_build_object('id', roles.id, 'app_id', roles.app_id, 'name', roles.name, 'description', roles.description, 'created_at', roles.created_at::text, 'permissions', roles.permissions)) AS roles
-	FROM 
-		users 
-	LEFT JOIN 
-		user_roles 
-	ON 
-		users.username = user_roles.username 
-	LEFT JOIN
-		(
-			SELECT
-				roles.id,
-				roles.app_id,
-				roles.name,
-				roles.description,
-				roles.created_at,
-	json_agg(json_build_object('id', permissions.id, 'app_id', permissions.app_id, 'name', permissions.name, 'description', permissions.description, 'created_at', permissions.created_at::text)) AS permissions
-			FROM
-				roles
-			JOIN
-				role_permissions ON roles.id = role_permissions.role_id AND roles.app_id = role_permissions.app_id
-			JOIN
-				permissions ON permissions.id = role_permissions.permission_id AND permissions.app_id = role_permissions.app_id
-			GROUP BY
-				roles.id, roles.app_id, roles.name, roles.description, roles.created_at
-		) AS roles 
-	ON 
-		user_roles.role_id = roles.id AND user_roles.app_id = roles.app_id
-	WHERE
-		users.username = $1
-	GROUP BY
-		users.username , users.created_at , users.updated_at
-	`
-	row := service.db.QueryRowContext(ctx, sql, userName)
+	WITH page AS (
+		SELECT users.username, users.created_at, users.updated_at, users.version
+		FROM users
+		WHERE users.username = $1 AND users.deleted_at IS NULL
+	)
+	` + usersSQL(view)
+	return scanUser(q.QueryRowContext(ctx, sql, userName))
+}
+
+// scanUser reads a row of usersSQL. Roles stay nil when they were not
+// selected.
+func scanUser(row interface{ Scan(...interface{}) error }) (*model.User, error) {
 	var user model.User
-	var roles string
-	if err := row.Scan(&user.UserName, &user.CreatedAt, &user.UpdatedAt, &roles); err != nil {
+	var roles *string
+	if err := row.Scan(&user.UserName, &user.CreatedAt, &user.UpdatedAt, &user.Version, &roles); err != nil {
 		return nil, err
 	}
+	if roles == nil {
+		return &user, nil
+	}
 	user.Roles = make([]*model.Role, 0)
-	if err := json.Unmarshal([]byte(roles), &user.Roles); err != nil {
+	if err := json.Unmarshal([]byte(*roles), &user.Roles); err != nil {
 		return nil, err
 	}
 	return &user, nil
 }
 
 func (service *service) GetRole(ctx context.Context, roleID string, appID string) (*model.Role, error) {
+	role, err := service.getRole(ctx, service.db, roleID, appID)
+	return role, notFoundAs(err, model.EntityRole, roleID, appID)
+}
+
+func (service *service) getRole(ctx context.Context, q querier, roleID string, appID string) (*model.Role, error) {
 	sql := `
 	SELECT 
 		roles.id,
@@ -273,23 +515,23 @@ func (service *service) GetRole(ctx context.Context, roleID string, appID string
 		roles.name,
 		roles.description,
 		roles.created_at,
-		json_agg(json_build_object('id', permissions.id, 'app_id', permissions.app_id, 'name', permissions.name, 'description', permissions.description,'created_at' , permissions.created_at::text)) AS permissions
+		roles.version,
+		COALESCE(json_agg(json_build_object('id', permissions.id, 'app_id', permissions.app_id, 'name', permissions.name, 'description', permissions.description,'created_at' , permissions.created_at::text)) FILTER (WHERE permissions.id IS NOT NULL), '[]') AS permissions
 	FROM 
 		roles
-	JOIN
+	LEFT JOIN
 		role_permissions ON roles.id = role_permissions.role_id AND roles.app_id = role_permissions.app_id
-	JOIN
-		permissions ON permissions.id = role_permissions.permission_id AND permissions.app_id = role_permissions.app_id
+	LEFT JOIN
+		permissions ON permissions.id = role_permissions.permission_id AND permissions.app_id = role_permissions.app_id AND permissions.deleted_at IS NULL
 	WHERE
-		roles.id = $1 AND roles.app_id = $2
+		roles.id = $1 AND roles.app_id = $2 AND roles.deleted_at IS NULL
 	GROUP BY
-		roles.id, roles.app_id, roles.name, roles.description, roles.created_at
+		roles.id, roles.app_id, roles.name, roles.description, roles.created_at, roles.version
 	`
-	row := service.db.QueryRowContext(ctx, sql, roleID, appID)
+	row := q.QueryRowContext(ctx, sql, roleID, appID)
 	var role model.Role
-	role.Permissions = make([]*model.Permission, 0)
 	var perms string
-	if err := row.Scan(&role.ID, &role.AppID, &role.Name, &role.Description, &role.CreatedAt, &perms); err != nil {
+	if err := row.Scan(&role.ID, &role.AppID, &role.Name, &role.Description, &role.CreatedAt, &role.Version, &perms); err != nil {
 		return nil, err
 	}
 	role.Permissions = make([]*model.Permission, 0)
@@ -301,50 +543,220 @@ func (service *service) GetRole(ctx context.Context, roleID string, appID string
 }
 
 func (service *service) UpsertApp(ctx context.Context, app *model.Application) error {
-	sql := "INSERT INTO applications (id, name, description) VALUES ($1, $2, $3) ON CONFLICT (id) DO UPDATE SET name = $2, description = $3"
-	_, err := service.db.ExecContext(ctx, sql, app.ID, app.Name, app.Description)
-	return err
+	return service.writeApp(ctx, app, writeUpsert)
+}
+
+func (service *service) CreateApp(ctx context.Context, app *model.Application) error {
+	return service.writeApp(ctx, app, writeCreate)
+}
+
+func (service *service) ReplaceApp(ctx context.Context, app *model.Application) error {
+	return service.writeApp(ctx, app, writeReplace)
+}
+
+func (service *service) writeApp(ctx context.Context, app *model.Application, mode writeMode) error {
+	return service.withTx(ctx, func(tx *sql.Tx) error {
+		if err := service.checkVersion(ctx, tx, appVersionSQL, app.ID); err != nil {
+			return err
+		}
+		before, err := service.findApp(ctx, tx, app.ID)
+		if err != nil {
+			return err
+		}
+		err = validation.Application(app)
+		if before != nil {
+			err = validation.Except(err, unchanged([]string{"id"}, app.Name, before.Name, app.Description, before.Description)...)
+		}
+		if err := validated(err); err != nil {
+			return err
+		}
+		if err := service.checkWriteMode(ctx, tx, mode, before != nil, model.EntityApplication, app.ID, "", appVersionSQL); err != nil {
+			return err
+		}
+
+		sql := "INSERT INTO applications (id, name, description) VALUES ($1, $2, $3) ON CONFLICT (id) DO UPDATE SET name = $2, description = $3, version = applications.version + 1"
+		if _, err := tx.ExecContext(ctx, sql, app.ID, app.Name, app.Description); err != nil {
+			return err
+		}
+
+		after, err := service.getApp(ctx, tx, app.ID)
+		if err != nil {
+			return err
+		}
+		return service.writeAudit(ctx, tx, upsertAction(before != nil), model.EntityApplication, app.ID, app.ID, before, after)
+	})
+}
+
+// unchanged lists the fields of an update that validation exempts because
+// they keep their stored value: the keys, which an update cannot change, and
+// the name and description when left as they are.
+func unchanged(keys []string, name string, storedName string, description string, storedDescription string) []string {
+	fields := keys
+	if name == storedName {
+		fields = append(fields, "name")
+	}
+	if description == storedDescription {
+		fields = append(fields, "description")
+	}
+	return fields
 }
 
 func (service *service) UpsertPerm(ctx context.Context, perm *model.Permission) error {
-	sql := "INSERT INTO permissions (id, app_id, name, description) VALUES ($1, $2, $3, $4) ON CONFLICT (id, app_id) DO UPDATE SET name = $3, description = $4"
-	_, err := service.db.ExecContext(ctx, sql, perm.ID, perm.AppID, perm.Name, perm.Description)
-	return err
+	return service.writePerm(ctx, perm, writeUpsert)
+}
+
+func (service *service) CreatePerm(ctx context.Context, perm *model.Permission) error {
+	return service.writePerm(ctx, perm, writeCreate)
+}
+
+func (service *service) ReplacePerm(ctx context.Context, perm *model.Permission) error {
+	return service.writePerm(ctx, perm, writeReplace)
+}
+
+func (service *service) writePerm(ctx context.Context, perm *model.Permission, mode writeMode) error {
+	return service.withTx(ctx, func(tx *sql.Tx) error {
+		if err := service.checkVersion(ctx, tx, permVersionSQL, perm.ID, perm.AppID); err != nil {
+			return err
+		}
+		before, err := service.findPerm(ctx, tx, perm.ID, perm.AppID)
+		if err != nil {
+			return err
+		}
+		err = validation.Permission(perm)
+		if before != nil {
+			err = validation.Except(err, unchanged([]string{"id", "app_id"}, perm.Name, before.Name, perm.Description, before.Description)...)
+		}
+		if err := validated(err); err != nil {
+			return err
+		}
+		if err := service.checkWriteMode(ctx, tx, mode, before != nil, model.EntityPermission, perm.ID, perm.AppID, permVersionSQL); err != nil {
+			return err
+		}
+
+		if err := service.requireApp(ctx, tx, perm.AppID); err != nil {
+			return err
+		}
+
+		sql := "INSERT INTO permissions (id, app_id, name, description) VALUES ($1, $2, $3, $4) ON CONFLICT (id, app_id) DO UPDATE SET name = $3, description = $4, version = permissions.version + 1"
+		if _, err := tx.ExecContext(ctx, sql, perm.ID, perm.AppID, perm.Name, perm.Description); err != nil {
+			return err
+		}
+
+		after, err := service.getPerm(ctx, tx, perm.ID, perm.AppID)
+		if err != nil {
+			return err
+		}
+		return service.writeAudit(ctx, tx, upsertAction(before != nil), model.EntityPermission, perm.ID, perm.AppID, before, after)
+	})
 }
 
 func (service *service) UpsertUser(ctx context.Context, user *model.User) error {
-	tx, err := service.db.BeginTx(ctx, nil)
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback()
+	return service.writeUser(ctx, user, writeUpsert)
+}
 
-	sql := "INSERT INTO users (username) VALUES ($1) ON CONFLICT (username) DO UPDATE SET updated_at = NOW()"
-	if _, err := tx.ExecContext(ctx, sql, user.UserName); err != nil {
-		return err
-	}
+func (service *service) CreateUser(ctx context.Context, user *model.User) error {
+	return service.writeUser(ctx, user, writeCreate)
+}
 
-	sql = "DELETE FROM user_roles WHERE username = $1"
-	if _, err := tx.ExecContext(ctx, sql, user.UserName); err != nil {
-		return err
-	}
+func (service *service) ReplaceUser(ctx context.Context, user *model.User) error {
+	return service.writeUser(ctx, user, writeReplace)
+}
 
-	sql = "INSERT INTO user_roles (username, role_id, app_id) VALUES ($1, $2, $3)"
-	for _, role := range user.Roles {
-		if _, err := tx.ExecContext(ctx, sql, user.UserName, role.ID, role.AppID); err != nil {
+func (service *service) writeUser(ctx context.Context, user *model.User, mode writeMode) error {
+	return service.withTx(ctx, func(tx *sql.Tx) error {
+		if err := service.checkVersion(ctx, tx, userVersionSQL, user.UserName); err != nil {
 			return err
 		}
-	}
-	return tx.Commit()
+		before, err := service.findUser(ctx, tx, user.UserName)
+		if err != nil {
+			return err
+		}
+		err = validation.User(user)
+		if before != nil {
+			err = validation.Except(err, "username")
+		}
+		if err := validated(err); err != nil {
+			return err
+		}
+		if err := service.checkWriteMode(ctx, tx, mode, before != nil, model.EntityUser, user.UserName, "", userVersionSQL); err != nil {
+			return err
+		}
+
+		sql := "INSERT INTO users (username) VALUES ($1) ON CONFLICT (username) DO UPDATE SET updated_at = NOW(), version = users.version + 1"
+		if _, err := tx.ExecContext(ctx, sql, user.UserName); err != nil {
+			return err
+		}
+
+		sql = "DELETE FROM user_roles WHERE username = $1"
+		if _, err := tx.ExecContext(ctx, sql, user.UserName); err != nil {
+			return err
+		}
+
+		// Selecting through roles keeps soft-deleted roles from being assigned.
+		sql = "INSERT INTO user_roles (username, role_id, app_id) SELECT $1, id, app_id FROM roles WHERE id = $2 AND app_id = $3 AND deleted_at IS NULL"
+		for _, role := range user.Roles {
+			res, err := tx.ExecContext(ctx, sql, user.UserName, role.ID, role.AppID)
+			if err != nil {
+				return err
+			}
+			if n, err := res.RowsAffected(); err != nil || n == 0 {
+				return missingRow(err, model.EntityRole, role.ID, role.AppID)
+			}
+		}
+
+		after, err := service.getUser(ctx, tx, user.UserName)
+		if err != nil {
+			return err
+		}
+		return service.writeAudit(ctx, tx, upsertAction(before != nil), model.EntityUser, user.UserName, "", before, after)
+	})
 }
 
 func (service *service) UpsertRole(ctx context.Context, role *model.Role) error {
-	tx, err := service.db.BeginTx(ctx, nil)
+	return service.withTx(ctx, func(tx *sql.Tx) error {
+		return service.writeRole(ctx, tx, role, writeUpsert, "")
+	})
+}
+
+func (service *service) CreateRole(ctx context.Context, role *model.Role) error {
+	return service.withTx(ctx, func(tx *sql.Tx) error {
+		return service.writeRole(ctx, tx, role, writeCreate, "")
+	})
+}
+
+func (service *service) ReplaceRole(ctx context.Context, role *model.Role) error {
+	return service.withTx(ctx, func(tx *sql.Tx) error {
+		return service.writeRole(ctx, tx, role, writeReplace, "")
+	})
+}
+
+// writeRole writes role and its permission set inside tx, then records a
+// new revision and an audit entry. An empty action is derived from whether
+// the role already existed.
+func (service *service) writeRole(ctx context.Context, tx *sql.Tx, role *model.Role, mode writeMode, action string) error {
+	if err := service.checkVersion(ctx, tx, roleVersionSQL, role.ID, role.AppID); err != nil {
+		return err
+	}
+	before, err := service.findRole(ctx, tx, role.ID, role.AppID)
 	if err != nil {
 		return err
 	}
-	defer tx.Rollback()
-	sql := "INSERT INTO roles (id, app_id, name, description) VALUES ($1, $2, $3, $4) ON CONFLICT (id, app_id) DO UPDATE SET name = $3, description = $4"
+	err = validation.Role(role)
+	if before != nil {
+		err = validation.Except(err, unchanged([]string{"id", "app_id"}, role.Name, before.Name, role.Description, before.Description)...)
+	}
+	if err := validated(err); err != nil {
+		return err
+	}
+	if err := service.checkWriteMode(ctx, tx, mode, before != nil, model.EntityRole, role.ID, role.AppID, roleVersionSQL); err != nil {
+		return err
+	}
+
+	if err := service.requireApp(ctx, tx, role.AppID); err != nil {
+		return err
+	}
+
+	sql := "INSERT INTO roles (id, app_id, name, description) VALUES ($1, $2, $3, $4) ON CONFLICT (id, app_id) DO UPDATE SET name = $3, description = $4, version = roles.version + 1"
 	if _, err := tx.ExecContext(ctx, sql, role.ID, role.AppID, role.Name, role.Description); err != nil {
 		return err
 	}
@@ -354,38 +766,156 @@ func (service *service) UpsertRole(ctx context.Context, role *model.Role) error
 		return err
 	}
 
-	sql = "INSERT INTO role_permissions (role_id, permission_id, app_id) VALUES ($1, $2, $3)"
+	// Selecting through permissions keeps soft-deleted permissions out.
+	sql = "INSERT INTO role_permissions (role_id, permission_id, app_id) SELECT $1, id, app_id FROM permissions WHERE id = $2 AND app_id = $3 AND deleted_at IS NULL"
 	for _, perm := range role.Permissions {
-		if _, err := tx.ExecContext(ctx, sql, role.ID, perm.ID, role.AppID); err != nil {
+		res, err := tx.ExecContext(ctx, sql, role.ID, perm.ID, role.AppID)
+		if err != nil {
 			return err
 		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			return missingRow(err, model.EntityPermission, perm.ID, role.AppID)
+		}
 	}
 
-	return tx.Commit()
+	after, err := service.getRole(ctx, tx, role.ID, role.AppID)
+	if err != nil {
+		return err
+	}
+	if err := service.recordRoleVersion(ctx, tx, after); err != nil {
+		return err
+	}
+	if action == "" {
+		action = upsertAction(before != nil)
+	}
+	return service.writeAudit(ctx, tx, action, model.EntityRole, role.ID, role.AppID, before, after)
 }
 
 func (service *service) DeleteApp(ctx context.Context, appID string) error {
-	sql := "DELETE FROM applications WHERE id = $1"
-	_, err := service.db.ExecContext(ctx, sql, appID)
-	return err
+	return service.withTx(ctx, func(tx *sql.Tx) error {
+		if err := service.checkVersion(ctx, tx, appVersionSQL, appID); err != nil {
+			return err
+		}
+		before, err := service.findApp(ctx, tx, appID)
+		if err != nil || before == nil {
+			return err
+		}
+
+		// Soft deletion cascades by hand, stamping children with the same
+		// deleted_at so that RestoreApp can tell them apart from children
+		// that were deleted on their own.
+		for _, sql := range []string{
+			"UPDATE applications SET deleted_at = LOCALTIMESTAMP, version = version + 1 WHERE id = $1 AND deleted_at IS NULL",
+			"UPDATE permissions SET deleted_at = LOCALTIMESTAMP, version = version + 1 WHERE app_id = $1 AND deleted_at IS NULL",
+			"UPDATE roles SET deleted_at = LOCALTIMESTAMP, version = version + 1 WHERE app_id = $1 AND deleted_at IS NULL",
+		} {
+			if _, err := tx.ExecContext(ctx, sql, appID); err != nil {
+				return err
+			}
+		}
+		if err := service.syncAssignmentHistory(ctx, tx, "app_id", appID); err != nil {
+			return err
+		}
+		return service.writeAudit(ctx, tx, model.AuditActionDelete, model.EntityApplication, appID, appID, before, nil)
+	})
 }
 
 func (service *service) DeletePerm(ctx context.Context, permID string, appID string) error {
-	sql := "DELETE FROM permissions WHERE id = $1 AND app_id = $2"
-	_, err := service.db.ExecContext(ctx, sql, permID, appID)
-	return err
+	return service.withTx(ctx, func(tx *sql.Tx) error {
+		if err := service.checkVersion(ctx, tx, permVersionSQL, permID, appID); err != nil {
+			return err
+		}
+		before, err := service.findPerm(ctx, tx, permID, appID)
+		if err != nil || before == nil {
+			return err
+		}
+
+		sql := "UPDATE permissions SET deleted_at = LOCALTIMESTAMP, version = version + 1 WHERE id = $1 AND app_id = $2 AND deleted_at IS NULL"
+		if _, err := tx.ExecContext(ctx, sql, permID, appID); err != nil {
+			return err
+		}
+		if err := service.syncRoleVersions(ctx, tx, appID); err != nil {
+			return err
+		}
+		return service.writeAudit(ctx, tx, model.AuditActionDelete, model.EntityPermission, permID, appID, before, nil)
+	})
 }
 
 func (service *service) DeleteUser(ctx context.Context, userName string) error {
-	sql := "DELETE FROM users WHERE username = $1"
-	_, err := service.db.ExecContext(ctx, sql, userName)
-	return err
+	return service.withTx(ctx, func(tx *sql.Tx) error {
+		if err := service.checkVersion(ctx, tx, userVersionSQL, userName); err != nil {
+			return err
+		}
+		before, err := service.findUser(ctx, tx, userName)
+		if err != nil || before == nil {
+			return err
+		}
+
+		sql := "UPDATE users SET deleted_at = LOCALTIMESTAMP, version = version + 1 WHERE username = $1 AND deleted_at IS NULL"
+		if _, err := tx.ExecContext(ctx, sql, userName); err != nil {
+			return err
+		}
+		if err := service.syncAssignmentHistory(ctx, tx, "username", userName); err != nil {
+			return err
+		}
+		return service.writeAudit(ctx, tx, model.AuditActionDelete, model.EntityUser, userName, "", before, nil)
+	})
 }
 
 func (service *service) DeleteRole(ctx context.Context, roleID string, appID string) error {
-	sql := "DELETE FROM roles WHERE id = $1 AND app_id = $2"
-	_, err := service.db.ExecContext(ctx, sql, roleID, appID)
-	return err
+	return service.withTx(ctx, func(tx *sql.Tx) error {
+		if err := service.checkVersion(ctx, tx, roleVersionSQL, roleID, appID); err != nil {
+			return err
+		}
+		before, err := service.findRole(ctx, tx, roleID, appID)
+		if err != nil || before == nil {
+			return err
+		}
+
+		sql := "UPDATE roles SET deleted_at = LOCALTIMESTAMP, version = version + 1 WHERE id = $1 AND app_id = $2 AND deleted_at IS NULL"
+		if _, err := tx.ExecContext(ctx, sql, roleID, appID); err != nil {
+			return err
+		}
+		if err := service.syncAssignmentHistory(ctx, tx, "app_id", appID); err != nil {
+			return err
+		}
+		return service.writeAudit(ctx, tx, model.AuditActionDelete, model.EntityRole, roleID, appID, before, nil)
+	})
+}
+
+// find* behave like get* but report a missing row as (nil, nil), which is
+// what the write paths want when deciding between create and update.
+
+func (service *service) findApp(ctx context.Context, q querier, appID string) (*model.Application, error) {
+	app, err := service.getApp(ctx, q, appID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return app, err
+}
+
+func (service *service) findPerm(ctx context.Context, q querier, permID string, appID string) (*model.Permission, error) {
+	perm, err := service.getPerm(ctx, q, permID, appID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return perm, err
+}
+
+func (service *service) findUser(ctx context.Context, q querier, userName string) (*model.User, error) {
+	user, err := service.getUser(ctx, q, userName)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return user, err
+}
+
+func (service *service) findRole(ctx context.Context, q querier, roleID string, appID string) (*model.Role, error) {
+	role, err := service.getRole(ctx, q, roleID, appID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return role, err
 }
 
 var (
@@ -402,8 +932,12 @@ func New() Service {
 	if err != nil {
 		log.Fatal(err)
 	}
-	s := &service{db: db}
-	return s
+	return NewFromDB(db)
+}
+
+// NewFromDB returns a Service backed by an already opened database.
+func NewFromDB(db *sql.DB) Service {
+	return &service{db: db}
 }
 
 func (s *service) Health() map[string]string {
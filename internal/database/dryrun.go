@@ -0,0 +1,128 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"guardian/internal/model"
+	"sort"
+)
+
+type txKey struct{}
+
+// accessSQL lists every (user, app, role, permission) grant that is visible
+// once soft deletion is taken into account. Roles without permissions are
+// kept with an empty permission so that assigning them still counts.
+const accessSQL = `
+	SELECT
+		user_roles.username,
+		user_roles.app_id,
+		user_roles.role_id,
+		COALESCE(permissions.id, '')
+	FROM
+		user_roles
+	JOIN
+		users ON users.username = user_roles.username AND users.deleted_at IS NULL
+	JOIN
+		roles ON roles.id = user_roles.role_id AND roles.app_id = user_roles.app_id AND roles.deleted_at IS NULL
+	LEFT JOIN
+		role_permissions ON role_permissions.role_id = roles.id AND role_permissions.app_id = roles.app_id
+	LEFT JOIN
+		permissions ON permissions.id = role_permissions.permission_id AND permissions.app_id = role_permissions.app_id AND permissions.deleted_at IS NULL
+`
+
+// DryRun runs fn against a transaction that is always rolled back, and
+// reports the rows fn inserted, updated and deleted per table, cascades and
+// triggers included, along with the users whose access it changed. Service
+// writes called with the ctx passed to fn join that transaction.
+func (service *service) DryRun(ctx context.Context, fn func(ctx context.Context) error) (*model.ChangeSummary, error) {
+	tx, err := service.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "CREATE TEMP TABLE dry_run_access ON COMMIT DROP AS "+accessSQL); err != nil {
+		return nil, err
+	}
+	before, err := tableStats(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		return nil, translate(err)
+	}
+
+	after, err := tableStats(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	summary := &model.ChangeSummary{
+		DryRun:        true,
+		Tables:        make([]*model.TableChanges, 0),
+		AffectedUsers: make([]string, 0),
+	}
+	for table, a := range after {
+		b := before[table]
+		changes := &model.TableChanges{
+			Table:    table,
+			Inserted: a.Inserted - b.Inserted,
+			Updated:  a.Updated - b.Updated,
+			Deleted:  a.Deleted - b.Deleted,
+		}
+		if changes.Inserted != 0 || changes.Updated != 0 || changes.Deleted != 0 {
+			summary.Tables = append(summary.Tables, changes)
+		}
+	}
+	sort.Slice(summary.Tables, func(i, j int) bool {
+		return summary.Tables[i].Table < summary.Tables[j].Table
+	})
+
+	query := `
+	SELECT DISTINCT changed.username FROM (
+		(SELECT * FROM dry_run_access EXCEPT (` + accessSQL + `))
+		UNION ALL
+		((` + accessSQL + `) EXCEPT SELECT * FROM dry_run_access)
+	) AS changed (username, app_id, role_id, permission_id)
+	ORDER BY changed.username
+	`
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var userName string
+		if err := rows.Scan(&userName); err != nil {
+			return nil, err
+		}
+		summary.AffectedUsers = append(summary.AffectedUsers, userName)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+// tableStats reads the per-table row counters of the current transaction.
+func tableStats(ctx context.Context, tx *sql.Tx) (map[string]model.TableChanges, error) {
+	query := `
+	SELECT relname, n_tup_ins, n_tup_upd, n_tup_del
+	FROM pg_stat_xact_user_tables
+	WHERE schemaname NOT LIKE 'pg_temp%'
+	`
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	stats := make(map[string]model.TableChanges)
+	for rows.Next() {
+		var s model.TableChanges
+		if err := rows.Scan(&s.Table, &s.Inserted, &s.Updated, &s.Deleted); err != nil {
+			return nil, err
+		}
+		stats[s.Table] = s
+	}
+	return stats, rows.Err()
+}
@@ -0,0 +1,130 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"guardian/internal/validation"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Kinds of failure reported by the service. Every *Error matches exactly one
+// of them with errors.Is.
+var (
+	ErrNotFound         = errors.New("not found")
+	ErrConflict         = errors.New("conflict")
+	ErrInvalidReference = errors.New("invalid reference")
+	ErrValidation       = errors.New("validation failed")
+)
+
+// Error is a failure the client can act on. Message is safe to show to the
+// client; the underlying cause, if any, is kept in Err and never is. Fields
+// lists the offending fields of a validation failure.
+type Error struct {
+	Kind    error
+	Code    string
+	Message string
+	Fields  validation.Errors
+	Err     error
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Is(target error) bool {
+	return target == e.Kind
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// describe names an entity in error messages. appID is empty for
+// applications and users.
+func describe(entity string, id string, appID string) string {
+	if appID == "" {
+		return fmt.Sprintf("%s %s", entity, id)
+	}
+	return fmt.Sprintf("%s %s of application %s", entity, id, appID)
+}
+
+func notFound(entity string, id string, appID string) error {
+	return &Error{
+		Kind:    ErrNotFound,
+		Code:    "not_found",
+		Message: describe(entity, id, appID) + " does not exist",
+		Err:     sql.ErrNoRows,
+	}
+}
+
+// notFoundAs turns sql.ErrNoRows from a lookup of the named entity into a
+// not found error and passes other errors through.
+func notFoundAs(err error, entity string, id string, appID string) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return notFound(entity, id, appID)
+	}
+	return err
+}
+
+func alreadyExists(entity string, id string, appID string) error {
+	return &Error{
+		Kind:    ErrConflict,
+		Code:    "already_exists",
+		Message: describe(entity, id, appID) + " already exists",
+	}
+}
+
+// validated turns the result of a validation function into a validation
+// error carrying its field errors.
+func validated(err error) error {
+	var fields validation.Errors
+	if !errors.As(err, &fields) {
+		return err
+	}
+	return &Error{
+		Kind:    ErrValidation,
+		Code:    "validation_failed",
+		Message: "the request has invalid fields",
+		Fields:  fields,
+	}
+}
+
+func invalid(format string, args ...interface{}) error {
+	return &Error{
+		Kind:    ErrValidation,
+		Code:    "validation_failed",
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// translate classifies errors that escape a transaction without having been
+// given a kind, so that constraint violations reach the client as such
+// rather than as raw SQL messages.
+func translate(err error) error {
+	var typed *Error
+	if err == nil || errors.As(err, &typed) || errors.Is(err, ErrPreconditionFailed) {
+		return err
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return &Error{Kind: ErrNotFound, Code: "not_found", Message: "the entity does not exist", Err: err}
+	}
+
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+	switch pgErr.Code {
+	case "23503": // foreign_key_violation
+		return &Error{Kind: ErrInvalidReference, Code: "invalid_reference", Message: "a referenced entity does not exist", Err: err}
+	case "23505": // unique_violation
+		return &Error{Kind: ErrConflict, Code: "conflict", Message: "the entity conflicts with an existing one", Err: err}
+	case "23502", "23514", "22001", "22003", "22007", "22008", "22P02":
+		// not_null_violation, check_violation, string_data_right_truncation,
+		// numeric_value_out_of_range, invalid_datetime_format,
+		// datetime_field_overflow, invalid_text_representation
+		return &Error{Kind: ErrValidation, Code: "validation_failed", Message: "a value is missing, out of range or malformed", Err: err}
+	}
+	return err
+}
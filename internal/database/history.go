@@ -0,0 +1,207 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"guardian/internal/model"
+	"sort"
+	"time"
+)
+
+// Point-in-time reads combine user_role_history, which records when each
+// assignment was valid, role_versions, which records what each role
+// contained, and entity_history, which records when each permission, role
+// and user was visible and under which name. Nothing is read from the live
+// tables, so deletions, restores and renames after as_of do not leak in.
+//
+// as_of values are bound as timestamptz and converted to the session time
+// zone, which is also the zone the TIMESTAMP columns are written in.
+
+// visibleAtSQL matches the entity_history interval of alias that contains
+// the as_of instant bound to $1.
+const visibleAtSQL = `%[1]s.valid_from <= CAST($1::timestamptz AS TIMESTAMP) AND (%[1]s.valid_to IS NULL OR %[1]s.valid_to > CAST($1::timestamptz AS TIMESTAMP))`
+
+var asOfRolesSQL = `
+	WITH state AS (
+		SELECT DISTINCT ON (role_versions.role_id, role_versions.app_id)
+			role_versions.role_id,
+			role_versions.app_id,
+			role_versions.name,
+			role_versions.description,
+			role_versions.permission_ids
+		FROM
+			role_versions
+		%s
+		WHERE
+			role_versions.created_at <= CAST($1::timestamptz AS TIMESTAMP) %s
+		ORDER BY
+			role_versions.role_id, role_versions.app_id, role_versions.version DESC
+	)
+	SELECT
+		state.role_id,
+		state.app_id,
+		state.name,
+		state.description,
+		perms.id,
+		COALESCE(perms.name, ''),
+		COALESCE(perms.description, '')
+	FROM
+		state
+	JOIN
+		entity_history AS role_history
+	ON
+		role_history.entity = 'role' AND role_history.id = state.role_id AND role_history.app_id = state.app_id
+		AND ` + fmt.Sprintf(visibleAtSQL, "role_history") + `
+	LEFT JOIN LATERAL (
+		SELECT
+			perm_history.id,
+			perm_history.name,
+			perm_history.description
+		FROM
+			jsonb_array_elements_text(state.permission_ids) AS perm_ids(permission_id)
+		JOIN
+			entity_history AS perm_history
+		ON
+			perm_history.entity = 'permission' AND perm_history.id = perm_ids.permission_id AND perm_history.app_id = state.app_id
+			AND ` + fmt.Sprintf(visibleAtSQL, "perm_history") + `
+	) AS perms ON TRUE
+	ORDER BY
+		state.app_id, state.role_id, perms.id
+`
+
+func scanAsOfRoles(rows *sql.Rows) ([]*model.Role, error) {
+	roles := make([]*model.Role, 0)
+	var current *model.Role
+	for rows.Next() {
+		var role model.Role
+		var permID sql.NullString
+		var permName, permDescription string
+		if err := rows.Scan(&role.ID, &role.AppID, &role.Name, &role.Description, &permID, &permName, &permDescription); err != nil {
+			return nil, err
+		}
+		if current == nil || current.ID != role.ID || current.AppID != role.AppID {
+			role.Permissions = make([]*model.Permission, 0)
+			current = &role
+			roles = append(roles, current)
+		}
+		if permID.Valid {
+			current.Permissions = append(current.Permissions, &model.Permission{
+				ID:          permID.String,
+				AppID:       current.AppID,
+				Name:        permName,
+				Description: permDescription,
+			})
+		}
+	}
+	return roles, rows.Err()
+}
+
+func (service *service) GetRoleAsOf(ctx context.Context, roleID string, appID string, asOf time.Time) (*model.Role, error) {
+	query := fmt.Sprintf(asOfRolesSQL, "", "AND role_versions.role_id = $2 AND role_versions.app_id = $3")
+	rows, err := service.db.QueryContext(ctx, query, asOf, roleID, appID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	roles, err := scanAsOfRoles(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(roles) == 0 {
+		return nil, notFound(model.EntityRole, roleID, appID)
+	}
+	return roles[0], nil
+}
+
+// GetUserAsOf returns the user as it was at asOf. CreatedAt is when the
+// user first appeared and UpdatedAt when it was last created or restored
+// before asOf.
+func (service *service) GetUserAsOf(ctx context.Context, userName string, asOf time.Time) (*model.User, error) {
+	query := `
+	SELECT
+		MIN(user_history.valid_from),
+		MAX(user_history.valid_from) FILTER (WHERE ` + fmt.Sprintf(visibleAtSQL, "user_history") + `)
+	FROM
+		entity_history AS user_history
+	WHERE
+		user_history.entity = 'user' AND user_history.id = $2 AND user_history.app_id = ''
+		AND user_history.valid_from <= CAST($1::timestamptz AS TIMESTAMP)
+	`
+	var created, current sql.NullTime
+	if err := service.db.QueryRowContext(ctx, query, asOf, userName).Scan(&created, &current); err != nil {
+		return nil, err
+	}
+	if !current.Valid {
+		return nil, notFound(model.EntityUser, userName, "")
+	}
+	user := &model.User{
+		UserName:  userName,
+		CreatedAt: model.Timestamp(created.Time),
+		UpdatedAt: model.Timestamp(current.Time),
+	}
+
+	join := `
+		JOIN
+			user_role_history
+		ON
+			user_role_history.role_id = role_versions.role_id AND user_role_history.app_id = role_versions.app_id`
+	cond := `
+			AND user_role_history.username = $2
+			AND ` + fmt.Sprintf(visibleAtSQL, "user_role_history")
+	rows, err := service.db.QueryContext(ctx, fmt.Sprintf(asOfRolesSQL, join, cond), asOf, userName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if user.Roles, err = scanAsOfRoles(rows); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// GetEffectivePermissions flattens the user's roles, now or as of asOf, into
+// the distinct permissions they grant. An empty appID covers every app.
+func (service *service) GetEffectivePermissions(ctx context.Context, userName string, appID string, asOf *time.Time) ([]*model.EffectivePermission, error) {
+	var user *model.User
+	var err error
+	if asOf != nil {
+		user, err = service.GetUserAsOf(ctx, userName, *asOf)
+	} else {
+		user, err = service.GetUser(ctx, userName, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	byKey := make(map[[2]string]*model.EffectivePermission)
+	perms := make([]*model.EffectivePermission, 0)
+	for _, role := range user.Roles {
+		if appID != "" && role.AppID != appID {
+			continue
+		}
+		for _, perm := range role.Permissions {
+			key := [2]string{role.AppID, perm.ID}
+			effective, ok := byKey[key]
+			if !ok {
+				effective = &model.EffectivePermission{
+					AppID:        role.AppID,
+					PermissionID: perm.ID,
+					Name:         perm.Name,
+					Description:  perm.Description,
+					Roles:        make([]string, 0, 1),
+				}
+				byKey[key] = effective
+				perms = append(perms, effective)
+			}
+			effective.Roles = append(effective.Roles, role.ID)
+		}
+	}
+	sort.Slice(perms, func(i, j int) bool {
+		if perms[i].AppID != perms[j].AppID {
+			return perms[i].AppID < perms[j].AppID
+		}
+		return perms[i].PermissionID < perms[j].PermissionID
+	})
+	return perms, nil
+}
@@ -0,0 +1,55 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"guardian/internal/model"
+)
+
+// ImportKeycloak applies a mapped Keycloak realm in one transaction: each
+// client manifest is imported as by ImportManifest, missing users are
+// created and their assignments granted. Nothing is removed, but an existing
+// application, permission or role takes the name and description of its
+// Keycloak counterpart, and an existing role the exact permission set mapped
+// for it. The changes made per client are listed in imp.Report.Applications.
+func (service *service) ImportKeycloak(ctx context.Context, imp *model.KeycloakImport) error {
+	ctx = withoutExpectedVersion(ctx)
+	for _, manifest := range imp.Manifests {
+		if err := checkManifest(manifest); err != nil {
+			return err
+		}
+	}
+
+	return service.withTx(ctx, func(tx *sql.Tx) error {
+		ctx := context.WithValue(ctx, txKey{}, tx)
+
+		imp.Report.Applications = make([]*model.ManifestResult, 0, len(imp.Manifests))
+		for _, manifest := range imp.Manifests {
+			result, err := service.ImportManifest(ctx, manifest)
+			if err != nil {
+				return err
+			}
+			imp.Report.Applications = append(imp.Report.Applications, result)
+		}
+
+		for _, userName := range imp.Users {
+			before, err := service.findUser(ctx, tx, userName)
+			if err != nil {
+				return err
+			}
+			if before != nil {
+				continue
+			}
+			if err := service.writeUser(ctx, &model.User{UserName: userName, Roles: make([]*model.Role, 0)}, writeUpsert); err != nil {
+				return err
+			}
+		}
+
+		for _, a := range imp.Assignments {
+			if _, err := service.GrantUserRole(ctx, a.UserName, a.RoleID, a.AppID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,114 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"guardian/internal/filter"
+	"guardian/internal/model"
+	"sort"
+)
+
+// ExportManifest describes an application, its permissions and its roles as
+// a manifest, everything ordered by ID.
+func (service *service) ExportManifest(ctx context.Context, appID string) (*model.Manifest, error) {
+	return service.exportManifest(ctx, service.db, appID)
+}
+
+func (service *service) exportManifest(ctx context.Context, q querier, appID string) (*model.Manifest, error) {
+	app, err := service.getApp(ctx, q, appID)
+	if err != nil {
+		return nil, notFoundAs(err, model.EntityApplication, appID, "")
+	}
+	opts := &ListOptions{Filter: filter.Compare{Field: "app_id", Op: filter.Eq, Value: appID}}
+	perms, _, err := service.getPerms(ctx, q, opts)
+	if err != nil {
+		return nil, err
+	}
+	roles, _, err := service.getRoles(ctx, q, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &model.Manifest{
+		Version: model.ManifestVersion,
+		Application: model.ManifestApplication{
+			ID:          app.ID,
+			Name:        app.Name,
+			Description: app.Description,
+		},
+		Permissions: make([]*model.ManifestPermission, 0, len(perms)),
+		Roles:       make([]*model.ManifestRole, 0, len(roles)),
+	}
+	for _, perm := range perms {
+		manifest.Permissions = append(manifest.Permissions, &model.ManifestPermission{
+			ID:          perm.ID,
+			Name:        perm.Name,
+			Description: perm.Description,
+		})
+	}
+	for _, role := range roles {
+		manifest.Roles = append(manifest.Roles, &model.ManifestRole{
+			ID:          role.ID,
+			Name:        role.Name,
+			Description: role.Description,
+			Permissions: permissionIDs(role),
+		})
+	}
+	return manifest, nil
+}
+
+// permissionIDs returns the sorted IDs of a role's permissions.
+func permissionIDs(role *model.Role) []string {
+	ids := make([]string, 0, len(role.Permissions))
+	for _, perm := range role.Permissions {
+		ids = append(ids, perm.ID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// ImportManifest creates or updates the application, permissions and roles
+// a manifest describes, all in one transaction. Entities that already match
+// are left alone, and entities missing from the manifest are kept.
+func (service *service) ImportManifest(ctx context.Context, manifest *model.Manifest) (*model.ManifestResult, error) {
+	if err := checkManifest(manifest); err != nil {
+		return nil, err
+	}
+	result := &model.ManifestResult{AppID: manifest.Application.ID}
+	err := service.withTx(ctx, func(tx *sql.Tx) error {
+		plan, err := service.planManifest(ctx, tx, manifest, false)
+		if err != nil {
+			return err
+		}
+		result.Changes = plan.Changes
+		return service.applyPlan(ctx, tx, manifest, plan)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// checkManifest rejects a manifest of another format version, or one that
+// declares a permission or role twice, which would otherwise silently apply
+// the last declaration.
+func checkManifest(manifest *model.Manifest) error {
+	if manifest.Version != model.ManifestVersion {
+		return invalid("unsupported manifest version %d", manifest.Version)
+	}
+	perms := make(map[string]bool, len(manifest.Permissions))
+	for _, perm := range manifest.Permissions {
+		if perms[perm.ID] {
+			return invalid("permission %s is declared more than once", perm.ID)
+		}
+		perms[perm.ID] = true
+	}
+	roles := make(map[string]bool, len(manifest.Roles))
+	for _, role := range manifest.Roles {
+		if roles[role.ID] {
+			return invalid("role %s is declared more than once", role.ID)
+		}
+		roles[role.ID] = true
+	}
+	return nil
+}
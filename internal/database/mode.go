@@ -0,0 +1,76 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// writeMode selects how a write treats an existing entity.
+type writeMode int
+
+const (
+	// writeUpsert creates the entity or overwrites it, but fails with
+	// ErrConflict if it is soft-deleted.
+	writeUpsert writeMode = iota
+	// writeCreate fails with ErrConflict if the entity exists.
+	writeCreate
+	// writeReplace fails with ErrNotFound unless the entity exists.
+	writeReplace
+)
+
+// checkWriteMode enforces mode given whether the entity is currently
+// visible. keySQL selects the entity by id, and appID unless empty,
+// regardless of soft deletion: a soft-deleted entity still holds its key
+// until it is restored or purged, and an upsert may not bring it back
+// behind the restore path's back.
+func (service *service) checkWriteMode(ctx context.Context, q querier, mode writeMode, visible bool, entity string, id string, appID string, keySQL string) error {
+	switch mode {
+	case writeCreate:
+		held, err := keyHeld(ctx, q, keySQL, id, appID)
+		if err != nil {
+			return err
+		}
+		if held {
+			return alreadyExists(entity, id, appID)
+		}
+	case writeUpsert:
+		if visible {
+			return nil
+		}
+		held, err := keyHeld(ctx, q, keySQL, id, appID)
+		if err != nil {
+			return err
+		}
+		if held {
+			return isDeleted(entity, id, appID)
+		}
+	case writeReplace:
+		if !visible {
+			return notFound(entity, id, appID)
+		}
+	}
+	return nil
+}
+
+func isDeleted(entity string, id string, appID string) error {
+	return &Error{
+		Kind:    ErrConflict,
+		Code:    "deleted",
+		Message: describe(entity, id, appID) + " is deleted; restore it first",
+	}
+}
+
+// keyHeld reports whether keySQL finds a row, deleted or not.
+func keyHeld(ctx context.Context, q querier, keySQL string, id string, appID string) (bool, error) {
+	args := []interface{}{id}
+	if appID != "" {
+		args = append(args, appID)
+	}
+	var version int
+	err := q.QueryRowContext(ctx, keySQL, args...).Scan(&version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
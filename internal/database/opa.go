@@ -0,0 +1,157 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"guardian/internal/model"
+	"strconv"
+)
+
+// OPAData reads every visible application, permission, role and assignment
+// from one snapshot, so that a policy bundle never mixes states.
+func (service *service) OPAData(ctx context.Context) (*model.OPAData, error) {
+	tx, err := service.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	revision, err := service.opaRevision(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	data := &model.OPAData{
+		Revision:    revision,
+		Apps:        make(map[string]*model.OPAApp),
+		Permissions: make(map[string]map[string]*model.OPAPermission),
+		Roles:       make(map[string]map[string]*model.OPARole),
+		UserRoles:   make(map[string]map[string][]string),
+	}
+
+	err = scanEach(ctx, tx, "SELECT id, name, description FROM applications WHERE deleted_at IS NULL", func(rows *sql.Rows) error {
+		var id string
+		var app model.OPAApp
+		if err := rows.Scan(&id, &app.Name, &app.Description); err != nil {
+			return err
+		}
+		data.Apps[id] = &app
+		data.Permissions[id] = make(map[string]*model.OPAPermission)
+		data.Roles[id] = make(map[string]*model.OPARole)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Children of a deleted application are stamped along with it, so the
+	// visible ones all belong to a visible application.
+	err = scanEach(ctx, tx, "SELECT id, app_id, name, description FROM permissions WHERE deleted_at IS NULL", func(rows *sql.Rows) error {
+		var id, appID string
+		var perm model.OPAPermission
+		if err := rows.Scan(&id, &appID, &perm.Name, &perm.Description); err != nil {
+			return err
+		}
+		if perms := data.Permissions[appID]; perms != nil {
+			perms[id] = &perm
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+	SELECT
+		roles.id,
+		roles.app_id,
+		roles.name,
+		roles.description,
+		COALESCE(json_agg(permissions.id ORDER BY permissions.id) FILTER (WHERE permissions.id IS NOT NULL), '[]')
+	FROM
+		roles
+	LEFT JOIN
+		role_permissions ON roles.id = role_permissions.role_id AND roles.app_id = role_permissions.app_id
+	LEFT JOIN
+		permissions ON permissions.id = role_permissions.permission_id AND permissions.app_id = role_permissions.app_id AND permissions.deleted_at IS NULL
+	WHERE
+		roles.deleted_at IS NULL
+	GROUP BY
+		roles.id, roles.app_id, roles.name, roles.description
+	`
+	err = scanEach(ctx, tx, query, func(rows *sql.Rows) error {
+		var id, appID string
+		var role model.OPARole
+		var perms string
+		if err := rows.Scan(&id, &appID, &role.Name, &role.Description, &perms); err != nil {
+			return err
+		}
+		if err := json.Unmarshal([]byte(perms), &role.Permissions); err != nil {
+			return err
+		}
+		if roles := data.Roles[appID]; roles != nil {
+			roles[id] = &role
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	query = "SELECT username, app_id, role_id FROM user_roles WHERE " + visibleAssignmentsSQL + " ORDER BY username, app_id, role_id"
+	err = scanEach(ctx, tx, query, func(rows *sql.Rows) error {
+		var a model.Assignment
+		if err := rows.Scan(&a.UserName, &a.AppID, &a.RoleID); err != nil {
+			return err
+		}
+		if data.UserRoles[a.UserName] == nil {
+			data.UserRoles[a.UserName] = make(map[string][]string)
+		}
+		data.UserRoles[a.UserName][a.AppID] = append(data.UserRoles[a.UserName][a.AppID], a.RoleID)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// opaRevisionSQL reads the sequence number of the newest audit entry, or of
+// the last one pruned if none is left. Every write appends an entry in its
+// own transaction, so the number moves exactly when the data may have
+// changed, and it is read from the seq indexes alone.
+const opaRevisionSQL = `
+	SELECT GREATEST(
+		COALESCE((SELECT MAX(seq) FROM audit_logs), 0),
+		COALESCE((SELECT MAX(seq) FROM audit_checkpoints), 0)
+	)
+`
+
+// OPARevision returns the revision OPAData would currently report, without
+// reading the data.
+func (service *service) OPARevision(ctx context.Context) (string, error) {
+	return service.opaRevision(ctx, service.db)
+}
+
+func (service *service) opaRevision(ctx context.Context, q querier) (string, error) {
+	var seq int64
+	if err := q.QueryRowContext(ctx, opaRevisionSQL).Scan(&seq); err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(seq, 10), nil
+}
+
+// scanEach runs query and calls fn for every row.
+func scanEach(ctx context.Context, q querier, query string, fn func(*sql.Rows) error, args ...interface{}) error {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := fn(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,190 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"guardian/internal/filter"
+	"guardian/internal/model"
+	"strings"
+	"time"
+)
+
+// ListOptions selects and pages the rows returned by a list method.
+//
+// Lists page with keysets: rows are ordered by a sort column and then by the
+// primary key, and a cursor holds those values for the last row returned, so
+// the next page starts right after it however rows were added or removed in
+// between.
+type ListOptions struct {
+	// Filter restricts the rows; nil matches every row. Each list only
+	// accepts fields from its own allowlist.
+	Filter filter.Expr
+	// Sort is a sortable column, "-" prefixed for descending order.
+	Sort string
+	// Cursor is the cursor returned with the previous page.
+	Cursor string
+	// Limit is the page size; zero returns every row.
+	Limit int
+}
+
+// cursorTimeLayout keeps the microseconds of TIMESTAMP columns, which a
+// cursor must round-trip exactly.
+const cursorTimeLayout = "2006-01-02 15:04:05.999999"
+
+type listSpec struct {
+	// table qualifies keys and sort columns.
+	table string
+	// keys is the primary key, which breaks ties between equal sort values.
+	keys []string
+	// sorts lists the columns a list can be sorted by.
+	sorts       []string
+	defaultSort string
+	// fields is the allowlist of filter fields.
+	fields filter.Fields
+}
+
+type listPage struct {
+	limit  int
+	sort   string
+	column string
+	desc   bool
+	after  []interface{}
+	keys   []string
+}
+
+type cursor struct {
+	Sort   string   `json:"s"`
+	Values []string `json:"v"`
+}
+
+// parsePage reads the paging options for a list described by spec.
+func parsePage(opts *ListOptions, spec listSpec) (*listPage, error) {
+	page := &listPage{sort: spec.defaultSort, keys: spec.keys, limit: opts.Limit}
+	if opts.Sort != "" {
+		page.sort = opts.Sort
+	}
+	page.column = strings.TrimPrefix(page.sort, "-")
+	page.desc = page.column != page.sort
+	if !contains(spec.sorts, page.column) {
+		return nil, invalid("cannot sort by %q, use one of %s", page.column, strings.Join(spec.sorts, ", "))
+	}
+
+	if opts.Cursor != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(opts.Cursor)
+		var c cursor
+		if err == nil {
+			err = json.Unmarshal(raw, &c)
+		}
+		if err != nil || len(c.Values) != 1+len(spec.keys) {
+			return nil, invalid("malformed cursor")
+		}
+		if c.Sort != page.sort {
+			return nil, invalid("cursor was issued for sort %q", c.Sort)
+		}
+		for _, v := range c.Values {
+			page.after = append(page.after, v)
+		}
+	}
+	return page, nil
+}
+
+// listWhere returns the WHERE condition of a list described by spec: visible
+// rows matching the filter, after the cursor if any.
+func listWhere(opts *ListOptions, spec listSpec, page *listPage) (string, []interface{}, error) {
+	cond, vals, err := compileFilter(opts.Filter, spec.fields)
+	if err != nil {
+		return "", nil, err
+	}
+	conds := []string{spec.table + ".deleted_at IS NULL", "(" + cond + ")"}
+	if cond, after := page.cond(spec.table); cond != "" {
+		conds = append(conds, cond)
+		vals = append(vals, after...)
+	}
+	return strings.Join(conds, " AND "), vals, nil
+}
+
+// compileFilter compiles expr over fields, reporting fields outside the
+// allowlist as validation errors.
+func compileFilter(expr filter.Expr, fields filter.Fields) (string, []interface{}, error) {
+	cond, vals, err := fields.SQL(expr)
+	var fieldErr *filter.FieldError
+	if errors.As(err, &fieldErr) {
+		return "", nil, &Error{Kind: ErrValidation, Code: "invalid_filter", Message: fieldErr.Error()}
+	}
+	return cond, vals, err
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// columns returns the sort column followed by the key, qualified by table.
+func (page *listPage) columns(table string) []string {
+	cols := []string{table + "." + page.column}
+	for _, key := range page.keys {
+		cols = append(cols, table+"."+key)
+	}
+	return cols
+}
+
+// cond returns the condition selecting rows after the cursor, if any, and
+// its bind values.
+func (page *listPage) cond(table string) (string, []interface{}) {
+	if page.after == nil {
+		return "", nil
+	}
+	op := ">"
+	if page.desc {
+		op = "<"
+	}
+	marks := strings.TrimSuffix(strings.Repeat("?, ", len(page.after)), ", ")
+	return fmt.Sprintf("(%s) %s (%s)", strings.Join(page.columns(table), ", "), op, marks), page.after
+}
+
+func (page *listPage) orderBy(table string) string {
+	cols := page.columns(table)
+	if page.desc {
+		for i := range cols {
+			cols[i] += " DESC"
+		}
+	}
+	return " ORDER BY " + strings.Join(cols, ", ")
+}
+
+// limitSQL fetches one row more than requested, which tells whether there is
+// a next page.
+func (page *listPage) limitSQL() string {
+	if page.limit <= 0 {
+		return ""
+	}
+	return fmt.Sprintf(" LIMIT %d", page.limit+1)
+}
+
+// next trims the extra row fetched by limitSQL and returns the cursor for
+// the following page, or "" on the last page. value returns the given
+// column of the i-th row.
+func (page *listPage) next(n int, value func(i int, column string) interface{}) (int, string) {
+	if page.limit <= 0 || n <= page.limit {
+		return n, ""
+	}
+	c := cursor{Sort: page.sort}
+	for _, column := range append([]string{page.column}, page.keys...) {
+		switch v := value(page.limit-1, column).(type) {
+		case model.Timestamp:
+			c.Values = append(c.Values, time.Time(v).Format(cursorTimeLayout))
+		case time.Time:
+			c.Values = append(c.Values, v.Format(cursorTimeLayout))
+		default:
+			c.Values = append(c.Values, fmt.Sprint(v))
+		}
+	}
+	raw, _ := json.Marshal(c)
+	return page.limit, base64.RawURLEncoding.EncodeToString(raw)
+}
@@ -0,0 +1,228 @@
+package database
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"guardian/internal/model"
+	"os"
+	"time"
+)
+
+// environment names this instance, say dev, staging or prod, in the bundles
+// it exports and the promotions it records.
+var environment = os.Getenv("GUARDIAN_ENVIRONMENT")
+
+// manifestDigest returns the hex SHA-256 of a manifest's JSON encoding.
+func manifestDigest(manifest *model.Manifest) (string, error) {
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// bundleKey is the secret shared by the instances a bundle may travel
+// between. It is read on use so that every signature follows the current
+// configuration.
+func bundleKey() ([]byte, error) {
+	key := os.Getenv("GUARDIAN_BUNDLE_KEY")
+	if key == "" {
+		return nil, errors.New("GUARDIAN_BUNDLE_KEY is not set; bundles cannot be signed or verified")
+	}
+	return []byte(key), nil
+}
+
+// bundleSignature returns the hex HMAC-SHA256 of a bundle's origin and
+// manifest digest under key, so that neither can be altered without it.
+func bundleSignature(key []byte, bundle *model.Bundle) (string, error) {
+	data, err := json.Marshal([]interface{}{bundle.Environment, bundle.ExportedAt, bundle.Digest})
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// ExportBundle packages an application's manifest for promotion into
+// another instance.
+func (service *service) ExportBundle(ctx context.Context, appID string) (*model.Bundle, error) {
+	manifest, err := service.exportManifest(ctx, service.db, appID)
+	if err != nil {
+		return nil, err
+	}
+	return NewBundle(manifest)
+}
+
+// NewBundle seals manifest into a bundle exported from this instance,
+// signed with GUARDIAN_BUNDLE_KEY.
+func NewBundle(manifest *model.Manifest) (*model.Bundle, error) {
+	key, err := bundleKey()
+	if err != nil {
+		return nil, err
+	}
+	digest, err := manifestDigest(manifest)
+	if err != nil {
+		return nil, err
+	}
+	bundle := &model.Bundle{
+		Environment: environment,
+		ExportedAt:  model.NewTimestampFromTime(time.Now()),
+		Digest:      digest,
+		Manifest:    manifest,
+	}
+	if bundle.Signature, err = bundleSignature(key, bundle); err != nil {
+		return nil, err
+	}
+	return bundle, nil
+}
+
+func checkBundle(bundle *model.Bundle) error {
+	if bundle == nil || bundle.Manifest == nil {
+		return invalid("bundle has no manifest")
+	}
+	if err := checkManifest(bundle.Manifest); err != nil {
+		return err
+	}
+	digest, err := manifestDigest(bundle.Manifest)
+	if err != nil {
+		return err
+	}
+	if digest != bundle.Digest {
+		return invalid("bundle digest does not match its manifest")
+	}
+	key, err := bundleKey()
+	if err != nil {
+		return err
+	}
+	signature, err := bundleSignature(key, bundle)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal([]byte(signature), []byte(bundle.Signature)) {
+		return invalid("bundle signature is not valid for this instance's bundle key")
+	}
+	return nil
+}
+
+// DiffBundle compares a bundle with the application it describes on this
+// instance. Permissions and roles the bundle lacks show up as deletions.
+func (service *service) DiffBundle(ctx context.Context, bundle *model.Bundle) (*model.PromotionDiff, error) {
+	if err := checkBundle(bundle); err != nil {
+		return nil, err
+	}
+	plan, err := service.planManifest(ctx, service.db, bundle.Manifest, true)
+	if err != nil {
+		return nil, err
+	}
+	target, err := service.exportManifest(ctx, service.db, plan.AppID)
+	if errors.Is(err, ErrNotFound) {
+		target = &model.Manifest{}
+	} else if err != nil {
+		return nil, err
+	}
+
+	diff := &model.PromotionDiff{
+		AppID:   plan.AppID,
+		Source:  bundle.Environment,
+		Target:  environment,
+		Changes: make([]*model.PromotionChange, 0, len(plan.Changes)),
+	}
+	for _, change := range plan.Changes {
+		diff.Changes = append(diff.Changes, &model.PromotionChange{
+			ManifestChange: change,
+			Source:         manifestEntity(bundle.Manifest, change.Entity, change.ID),
+			Target:         manifestEntity(target, change.Entity, change.ID),
+		})
+	}
+	return diff, nil
+}
+
+// manifestEntity returns the declaration of an entity in manifest, or nil.
+func manifestEntity(manifest *model.Manifest, entity string, id string) interface{} {
+	switch entity {
+	case model.EntityApplication:
+		if manifest.Application.ID == id {
+			return &manifest.Application
+		}
+	case model.EntityPermission:
+		for _, perm := range manifest.Permissions {
+			if perm.ID == id {
+				return perm
+			}
+		}
+	case model.EntityRole:
+		for _, role := range manifest.Roles {
+			if role.ID == id {
+				return role
+			}
+		}
+	}
+	return nil
+}
+
+// Promote applies the selected changes of a bundle's diff in one
+// transaction and records the promotion in the audit log. Selecting a
+// change that is no longer in the diff fails the whole promotion, since the
+// target moved on from what was reviewed.
+func (service *service) Promote(ctx context.Context, promotion *model.Promotion) (*model.PromotionResult, error) {
+	if err := checkBundle(promotion.Bundle); err != nil {
+		return nil, err
+	}
+	if len(promotion.Select) == 0 {
+		return nil, invalid("no changes selected")
+	}
+	manifest := promotion.Bundle.Manifest
+
+	result := &model.PromotionResult{
+		AppID:   manifest.Application.ID,
+		Source:  promotion.Bundle.Environment,
+		Target:  environment,
+		Digest:  promotion.Bundle.Digest,
+		Applied: make([]*model.ManifestChange, 0, len(promotion.Select)),
+	}
+	err := service.withTx(ctx, func(tx *sql.Tx) error {
+		plan, err := service.planManifest(ctx, tx, manifest, true)
+		if err != nil {
+			return err
+		}
+		selected := make(map[model.ChangeRef]bool, len(promotion.Select))
+		for _, ref := range promotion.Select {
+			if ref != nil {
+				selected[*ref] = true
+			}
+		}
+		for _, change := range plan.Changes {
+			ref := model.ChangeRef{Entity: change.Entity, ID: change.ID}
+			if selected[ref] {
+				result.Applied = append(result.Applied, change)
+				delete(selected, ref)
+			}
+		}
+		for _, ref := range promotion.Select {
+			if ref != nil && selected[*ref] {
+				appID := result.AppID
+				if ref.Entity == model.EntityApplication {
+					appID = ""
+				}
+				return invalid("%s has no pending change", describe(ref.Entity, ref.ID, appID))
+			}
+		}
+
+		plan.Changes = result.Applied
+		if err := service.applyPlan(ctx, tx, manifest, plan); err != nil {
+			return err
+		}
+		return service.writeAudit(ctx, tx, model.AuditActionPromote, model.EntityApplication, result.AppID, result.AppID, nil, result)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
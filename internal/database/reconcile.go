@@ -0,0 +1,260 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"guardian/internal/filter"
+	"guardian/internal/model"
+	"strings"
+)
+
+// Reconciliation converges an application on a manifest kept elsewhere,
+// typically in git. Planning compares the two, applying makes the planned
+// changes in one transaction and then marks every declared entity as
+// managed at its new version in managed_entities. Edits made afterwards
+// through the admin API bump the version away from the marker, which is
+// how drift is detected.
+
+// PlanManifest returns the changes ApplyManifest would make, without making
+// them.
+func (service *service) PlanManifest(ctx context.Context, manifest *model.Manifest, prune bool) (*model.Plan, error) {
+	if err := checkManifest(manifest); err != nil {
+		return nil, err
+	}
+	return service.planManifest(ctx, service.db, manifest, prune)
+}
+
+// ApplyManifest reconciles the application a manifest describes with it and
+// returns the plan it carried out.
+func (service *service) ApplyManifest(ctx context.Context, manifest *model.Manifest, prune bool) (*model.Plan, error) {
+	if err := checkManifest(manifest); err != nil {
+		return nil, err
+	}
+	var plan *model.Plan
+	err := service.withTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		if plan, err = service.planManifest(ctx, tx, manifest, prune); err != nil {
+			return err
+		}
+		if err := service.applyPlan(ctx, tx, manifest, plan); err != nil {
+			return err
+		}
+		plan.Applied = true
+		return service.markManaged(ctx, tx, manifest)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// manifestEntities returns the entities a manifest declares, keyed by ID.
+func manifestEntities(manifest *model.Manifest) (*model.Application, map[string]*model.Permission, map[string]*model.Role) {
+	appID := manifest.Application.ID
+	app := &model.Application{ID: appID, Name: manifest.Application.Name, Description: manifest.Application.Description}
+	perms := make(map[string]*model.Permission, len(manifest.Permissions))
+	for _, p := range manifest.Permissions {
+		perms[p.ID] = &model.Permission{ID: p.ID, AppID: appID, Name: p.Name, Description: p.Description}
+	}
+	roles := make(map[string]*model.Role, len(manifest.Roles))
+	for _, r := range manifest.Roles {
+		role := &model.Role{ID: r.ID, AppID: appID, Name: r.Name, Description: r.Description, Permissions: make([]*model.Permission, 0, len(r.Permissions))}
+		for _, permID := range r.Permissions {
+			role.Permissions = append(role.Permissions, &model.Permission{ID: permID, AppID: appID})
+		}
+		roles[r.ID] = role
+	}
+	return app, perms, roles
+}
+
+// changedFields names the fields that differ between the current and the
+// desired name, description and, for roles, permission set.
+func changedFields(name, description [2]string, perms ...[]string) []string {
+	var fields []string
+	if name[0] != name[1] {
+		fields = append(fields, "name")
+	}
+	if description[0] != description[1] {
+		fields = append(fields, "description")
+	}
+	if len(perms) == 2 && strings.Join(perms[0], "\x00") != strings.Join(perms[1], "\x00") {
+		fields = append(fields, "permissions")
+	}
+	return fields
+}
+
+func (service *service) planManifest(ctx context.Context, q querier, manifest *model.Manifest, prune bool) (*model.Plan, error) {
+	appID := manifest.Application.ID
+	app, perms, roles := manifestEntities(manifest)
+	plan := &model.Plan{AppID: appID, Prune: prune, Changes: make([]*model.ManifestChange, 0)}
+	change := func(entity string, id string, action string, fields []string) {
+		plan.Changes = append(plan.Changes, &model.ManifestChange{Entity: entity, ID: id, Action: action, Fields: fields})
+	}
+
+	current, err := service.findApp(ctx, q, appID)
+	if err != nil {
+		return nil, err
+	}
+	if current == nil {
+		change(model.EntityApplication, appID, model.ManifestCreate, nil)
+	} else if fields := changedFields([2]string{current.Name, app.Name}, [2]string{current.Description, app.Description}); fields != nil {
+		change(model.EntityApplication, appID, model.ManifestUpdate, fields)
+	}
+
+	opts := &ListOptions{Filter: filter.Compare{Field: "app_id", Op: filter.Eq, Value: appID}}
+	currentPerms, _, err := service.getPerms(ctx, q, opts)
+	if err != nil {
+		return nil, err
+	}
+	currentRoles, _, err := service.getRoles(ctx, q, opts)
+	if err != nil {
+		return nil, err
+	}
+	permsByID := make(map[string]*model.Permission, len(currentPerms))
+	for _, perm := range currentPerms {
+		permsByID[perm.ID] = perm
+	}
+	rolesByID := make(map[string]*model.Role, len(currentRoles))
+	for _, role := range currentRoles {
+		rolesByID[role.ID] = role
+	}
+
+	for _, p := range manifest.Permissions {
+		perm := perms[p.ID]
+		if current, ok := permsByID[p.ID]; !ok {
+			change(model.EntityPermission, perm.ID, model.ManifestCreate, nil)
+		} else if fields := changedFields([2]string{current.Name, perm.Name}, [2]string{current.Description, perm.Description}); fields != nil {
+			change(model.EntityPermission, perm.ID, model.ManifestUpdate, fields)
+		}
+	}
+	for _, r := range manifest.Roles {
+		role := roles[r.ID]
+		if current, ok := rolesByID[r.ID]; !ok {
+			change(model.EntityRole, role.ID, model.ManifestCreate, nil)
+		} else if fields := changedFields([2]string{current.Name, role.Name}, [2]string{current.Description, role.Description}, permissionIDs(current), permissionIDs(role)); fields != nil {
+			change(model.EntityRole, role.ID, model.ManifestUpdate, fields)
+		}
+	}
+	// Roles go before permissions so that no role revision is recorded for
+	// a permission that is about to disappear from it anyway.
+	if prune {
+		for _, role := range currentRoles {
+			if roles[role.ID] == nil {
+				change(model.EntityRole, role.ID, model.ManifestDelete, nil)
+			}
+		}
+		for _, perm := range currentPerms {
+			if perms[perm.ID] == nil {
+				change(model.EntityPermission, perm.ID, model.ManifestDelete, nil)
+			}
+		}
+	}
+
+	if plan.Drift, err = service.detectDrift(ctx, q, appID); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// applyPlan carries out plan, made from manifest, inside tx.
+func (service *service) applyPlan(ctx context.Context, tx *sql.Tx, manifest *model.Manifest, plan *model.Plan) error {
+	ctx = context.WithValue(withoutExpectedVersion(ctx), txKey{}, tx)
+	app, perms, roles := manifestEntities(manifest)
+	for _, change := range plan.Changes {
+		var err error
+		switch {
+		case change.Action == model.ManifestDelete && change.Entity == model.EntityRole:
+			err = service.DeleteRole(ctx, change.ID, plan.AppID)
+		case change.Action == model.ManifestDelete && change.Entity == model.EntityPermission:
+			err = service.DeletePerm(ctx, change.ID, plan.AppID)
+		case change.Entity == model.EntityApplication:
+			err = service.writeApp(ctx, app, writeUpsert)
+		case change.Entity == model.EntityPermission:
+			err = service.writePerm(ctx, perms[change.ID], writeUpsert)
+		case change.Entity == model.EntityRole:
+			err = service.writeRole(ctx, tx, roles[change.ID], writeUpsert, "")
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// markManaged records the application and everything the manifest declares
+// as managed at their current versions, and forgets entities it no longer
+// declares.
+func (service *service) markManaged(ctx context.Context, tx *sql.Tx, manifest *model.Manifest) error {
+	appID := manifest.Application.ID
+	permIDs := make([]string, 0, len(manifest.Permissions))
+	for _, perm := range manifest.Permissions {
+		permIDs = append(permIDs, perm.ID)
+	}
+	roleIDs := make([]string, 0, len(manifest.Roles))
+	for _, role := range manifest.Roles {
+		roleIDs = append(roleIDs, role.ID)
+	}
+
+	sql := "DELETE FROM managed_entities WHERE app_id = $1"
+	if _, err := tx.ExecContext(ctx, sql, appID); err != nil {
+		return err
+	}
+	sql = `
+	INSERT INTO managed_entities (entity, id, app_id, version)
+	SELECT 'application', id, id, version FROM applications WHERE id = $1
+	UNION ALL
+	SELECT 'permission', id, app_id, version FROM permissions WHERE app_id = $1 AND id = ANY($2) AND deleted_at IS NULL
+	UNION ALL
+	SELECT 'role', id, app_id, version FROM roles WHERE app_id = $1 AND id = ANY($3) AND deleted_at IS NULL
+	`
+	_, err := tx.ExecContext(ctx, sql, appID, permIDs, roleIDs)
+	return err
+}
+
+// DetectDrift lists the managed entities of an application that were
+// edited or deleted outside of reconciliation since it last ran.
+func (service *service) DetectDrift(ctx context.Context, appID string) ([]*model.Drift, error) {
+	return service.detectDrift(ctx, service.db, appID)
+}
+
+func (service *service) detectDrift(ctx context.Context, q querier, appID string) ([]*model.Drift, error) {
+	sql := `
+	SELECT
+		managed_entities.entity,
+		managed_entities.id,
+		managed_entities.version,
+		COALESCE(current.version, 0),
+		COALESCE(current.deleted, TRUE),
+		managed_entities.applied_at
+	FROM
+		managed_entities
+	LEFT JOIN
+		(
+			SELECT 'application' AS entity, id, id AS app_id, version, deleted_at IS NOT NULL AS deleted FROM applications WHERE id = $1
+			UNION ALL
+			SELECT 'permission', id, app_id, version, deleted_at IS NOT NULL FROM permissions WHERE app_id = $1
+			UNION ALL
+			SELECT 'role', id, app_id, version, deleted_at IS NOT NULL FROM roles WHERE app_id = $1
+		) AS current
+	ON
+		current.entity = managed_entities.entity AND current.id = managed_entities.id AND current.app_id = managed_entities.app_id
+	WHERE
+		managed_entities.app_id = $1 AND (current.version IS DISTINCT FROM managed_entities.version OR current.deleted)
+	ORDER BY
+		managed_entities.entity, managed_entities.id
+	`
+	rows, err := q.QueryContext(ctx, sql, appID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	drift := make([]*model.Drift, 0)
+	for rows.Next() {
+		var d model.Drift
+		if err := rows.Scan(&d.Entity, &d.ID, &d.ManagedVersion, &d.CurrentVersion, &d.Deleted, &d.AppliedAt); err != nil {
+			return nil, err
+		}
+		drift = append(drift, &d)
+	}
+	return drift, rows.Err()
+}
@@ -0,0 +1,106 @@
+package database
+
+import (
+	"context"
+	"guardian/internal/filter"
+	"guardian/internal/model"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// membersSQL selects the visible users assigned to role ? of application ?
+// as the members table, dated by the open interval of their assignment.
+const membersSQL = `
+	SELECT
+		users.username,
+		users.deleted_at,
+		COALESCE(user_role_history.valid_from, users.updated_at) AS assigned_at
+	FROM
+		user_roles
+	JOIN
+		users ON users.username = user_roles.username
+	LEFT JOIN
+		user_role_history
+	ON
+		user_role_history.username = user_roles.username
+		AND user_role_history.role_id = user_roles.role_id
+		AND user_role_history.app_id = user_roles.app_id
+		AND user_role_history.valid_to IS NULL
+	WHERE
+		user_roles.role_id = ? AND user_roles.app_id = ?
+`
+
+var memberList = listSpec{
+	table:       "members",
+	keys:        []string{"username"},
+	sorts:       []string{"username", "assigned_at"},
+	defaultSort: "username",
+	fields: filter.Fields{
+		"username":    {Column: "members.username"},
+		"assigned_at": {Column: "members.assigned_at", Kind: filter.Time},
+	},
+}
+
+// GetRoleMembers lists the users assigned to a role.
+func (service *service) GetRoleMembers(ctx context.Context, roleID string, appID string, opts *ListOptions) ([]*model.RoleMember, string, error) {
+	if opts == nil {
+		opts = &ListOptions{}
+	}
+	if _, err := service.GetRole(ctx, roleID, appID); err != nil {
+		return nil, "", err
+	}
+	page, err := parsePage(opts, memberList)
+	if err != nil {
+		return nil, "", err
+	}
+	where, vals, err := listWhere(opts, memberList, page)
+	if err != nil {
+		return nil, "", err
+	}
+
+	query := "SELECT members.username, members.assigned_at FROM (" + membersSQL + ") AS members WHERE " + where + page.orderBy("members") + page.limitSQL()
+	rows, err := service.db.QueryContext(ctx, sqlx.Rebind(sqlx.DOLLAR, query), append([]interface{}{roleID, appID}, vals...)...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+	members := make([]*model.RoleMember, 0)
+	for rows.Next() {
+		var member model.RoleMember
+		if err := rows.Scan(&member.UserName, &member.AssignedAt); err != nil {
+			return nil, "", err
+		}
+		members = append(members, &member)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	n, next := page.next(len(members), func(i int, column string) interface{} {
+		if column == "assigned_at" {
+			return members[i].AssignedAt
+		}
+		return members[i].UserName
+	})
+	return members[:n], next, nil
+}
+
+// CountRoleMembers counts the users assigned to a role that match
+// opts.Filter; paging options are ignored.
+func (service *service) CountRoleMembers(ctx context.Context, roleID string, appID string, opts *ListOptions) (int, error) {
+	if opts == nil {
+		opts = &ListOptions{}
+	}
+	if _, err := service.GetRole(ctx, roleID, appID); err != nil {
+		return 0, err
+	}
+	where, vals, err := compileFilter(opts.Filter, memberList.fields)
+	if err != nil {
+		return 0, err
+	}
+
+	query := "SELECT count(*) FROM (" + membersSQL + ") AS members WHERE members.deleted_at IS NULL AND (" + where + ")"
+	var count int
+	err = service.db.QueryRowContext(ctx, sqlx.Rebind(sqlx.DOLLAR, query), append([]interface{}{roleID, appID}, vals...)...).Scan(&count)
+	return count, err
+}
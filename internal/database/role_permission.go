@@ -0,0 +1,110 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"guardian/internal/model"
+)
+
+func (service *service) AttachRolePermission(ctx context.Context, roleID string, appID string, permID string) (bool, error) {
+	changes, err := service.UpdateRolePermissions(ctx, roleID, appID, &model.RolePermissionDelta{Add: []string{permID}})
+	if err != nil {
+		return false, err
+	}
+	return len(changes.Added) > 0, nil
+}
+
+func (service *service) DetachRolePermission(ctx context.Context, roleID string, appID string, permID string) (bool, error) {
+	changes, err := service.UpdateRolePermissions(ctx, roleID, appID, &model.RolePermissionDelta{Remove: []string{permID}})
+	if err != nil {
+		return false, err
+	}
+	return len(changes.Removed) > 0, nil
+}
+
+// UpdateRolePermissions applies delta to a role's permission set in one
+// transaction. Only changes that took effect are reported, and a new role
+// revision is recorded only if there was at least one.
+func (service *service) UpdateRolePermissions(ctx context.Context, roleID string, appID string, delta *model.RolePermissionDelta) (*model.RolePermissionChanges, error) {
+	removing := make(map[string]bool, len(delta.Remove))
+	for _, permID := range delta.Remove {
+		removing[permID] = true
+	}
+	for _, permID := range delta.Add {
+		if removing[permID] {
+			return nil, invalid("permission %s is both added and removed", permID)
+		}
+	}
+
+	changes := &model.RolePermissionChanges{
+		Added:   make([]string, 0),
+		Removed: make([]string, 0),
+	}
+	err := service.withTx(ctx, func(tx *sql.Tx) error {
+		if err := service.checkVersion(ctx, tx, roleVersionSQL, roleID, appID); err != nil {
+			return err
+		}
+		before, err := service.getRole(ctx, tx, roleID, appID)
+		if err != nil {
+			return err
+		}
+
+		query := "INSERT INTO role_permissions (role_id, permission_id, app_id) SELECT $1, id, app_id FROM permissions WHERE id = $2 AND app_id = $3 AND deleted_at IS NULL ON CONFLICT DO NOTHING"
+		for _, permID := range delta.Add {
+			res, err := tx.ExecContext(ctx, query, roleID, permID, appID)
+			if err != nil {
+				return err
+			}
+			n, err := res.RowsAffected()
+			if err != nil {
+				return err
+			}
+			if n > 0 {
+				changes.Added = append(changes.Added, permID)
+				continue
+			}
+			// Either already attached or the permission does not exist.
+			if _, err := service.getPerm(ctx, tx, permID, appID); errors.Is(err, sql.ErrNoRows) {
+				return missingRow(nil, model.EntityPermission, permID, appID)
+			} else if err != nil {
+				return err
+			}
+		}
+
+		query = "DELETE FROM role_permissions WHERE role_id = $1 AND permission_id = $2 AND app_id = $3"
+		for _, permID := range delta.Remove {
+			res, err := tx.ExecContext(ctx, query, roleID, permID, appID)
+			if err != nil {
+				return err
+			}
+			n, err := res.RowsAffected()
+			if err != nil {
+				return err
+			}
+			if n > 0 {
+				changes.Removed = append(changes.Removed, permID)
+			}
+		}
+
+		if len(changes.Added) == 0 && len(changes.Removed) == 0 {
+			return nil
+		}
+		query = "UPDATE roles SET version = version + 1 WHERE id = $1 AND app_id = $2"
+		if _, err := tx.ExecContext(ctx, query, roleID, appID); err != nil {
+			return err
+		}
+		after, err := service.getRole(ctx, tx, roleID, appID)
+		if err != nil {
+			return err
+		}
+		if err := service.recordRoleVersion(ctx, tx, after); err != nil {
+			return err
+		}
+		return service.writeAudit(ctx, tx, model.AuditActionUpdate, model.EntityRole, roleID, appID, before, after)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
@@ -0,0 +1,186 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"guardian/internal/model"
+	"sort"
+)
+
+// recordRoleVersion appends the current state of role to its history.
+// role_versions has no foreign key to roles so history outlives the role.
+func (service *service) recordRoleVersion(ctx context.Context, q querier, role *model.Role) error {
+	permIDs := make([]string, 0, len(role.Permissions))
+	for _, perm := range role.Permissions {
+		permIDs = append(permIDs, perm.ID)
+	}
+	sort.Strings(permIDs)
+	b, err := json.Marshal(permIDs)
+	if err != nil {
+		return err
+	}
+
+	sql := `
+	INSERT INTO role_versions (role_id, app_id, version, name, description, permission_ids, actor)
+	SELECT $1, $2, COALESCE(MAX(version), 0) + 1, $3, $4, $5::jsonb, $6
+	FROM role_versions
+	WHERE role_id = $1 AND app_id = $2
+	`
+	_, err = q.ExecContext(ctx, sql, role.ID, role.AppID, role.Name, role.Description, string(b), actorFrom(ctx))
+	return err
+}
+
+func scanRoleVersion(row interface{ Scan(...interface{}) error }) (*model.RoleVersion, error) {
+	var version model.RoleVersion
+	var permIDs []byte
+	if err := row.Scan(&version.RoleID, &version.AppID, &version.Version, &version.Name, &version.Description, &permIDs, &version.Actor, &version.CreatedAt); err != nil {
+		return nil, err
+	}
+	version.PermissionIDs = make([]string, 0)
+	if err := json.Unmarshal(permIDs, &version.PermissionIDs); err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+func (service *service) GetRoleVersions(ctx context.Context, roleID string, appID string) ([]*model.RoleVersion, error) {
+	sql := `
+	SELECT
+		role_id, app_id, version, name, description, permission_ids, actor, created_at
+	FROM
+		role_versions
+	WHERE
+		role_id = $1 AND app_id = $2
+	ORDER BY
+		version DESC
+	`
+	rows, err := service.db.QueryContext(ctx, sql, roleID, appID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	versions := make([]*model.RoleVersion, 0)
+	for rows.Next() {
+		version, err := scanRoleVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, version)
+	}
+	return versions, rows.Err()
+}
+
+func (service *service) GetRoleVersion(ctx context.Context, roleID string, appID string, version int) (*model.RoleVersion, error) {
+	v, err := service.getRoleVersion(ctx, service.db, roleID, appID, version)
+	return v, notFoundAs(err, model.EntityRole, fmt.Sprintf("%s version %d", roleID, version), appID)
+}
+
+func (service *service) getRoleVersion(ctx context.Context, q querier, roleID string, appID string, version int) (*model.RoleVersion, error) {
+	sql := `
+	SELECT
+		role_id, app_id, version, name, description, permission_ids, actor, created_at
+	FROM
+		role_versions
+	WHERE
+		role_id = $1 AND app_id = $2 AND version = $3
+	`
+	return scanRoleVersion(q.QueryRowContext(ctx, sql, roleID, appID, version))
+}
+
+func (service *service) DiffRoleVersions(ctx context.Context, roleID string, appID string, from int, to int) (*model.RoleVersionDiff, error) {
+	a, err := service.GetRoleVersion(ctx, roleID, appID, from)
+	if err != nil {
+		return nil, err
+	}
+	b, err := service.GetRoleVersion(ctx, roleID, appID, to)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &model.RoleVersionDiff{
+		RoleID:             roleID,
+		AppID:              appID,
+		From:               from,
+		To:                 to,
+		AddedPermissions:   make([]string, 0),
+		RemovedPermissions: make([]string, 0),
+	}
+	if a.Name != b.Name {
+		diff.Name = &model.FieldChange{From: a.Name, To: b.Name}
+	}
+	if a.Description != b.Description {
+		diff.Description = &model.FieldChange{From: a.Description, To: b.Description}
+	}
+	diff.AddedPermissions = stringsMissing(b.PermissionIDs, a.PermissionIDs)
+	diff.RemovedPermissions = stringsMissing(a.PermissionIDs, b.PermissionIDs)
+	return diff, nil
+}
+
+// stringsMissing returns the members of xs that are not in ys.
+func stringsMissing(xs []string, ys []string) []string {
+	seen := make(map[string]bool, len(ys))
+	for _, y := range ys {
+		seen[y] = true
+	}
+	missing := make([]string, 0)
+	for _, x := range xs {
+		if !seen[x] {
+			missing = append(missing, x)
+		}
+	}
+	return missing
+}
+
+// RollbackRole restores the name, description and permission set captured in
+// version. The rollback itself becomes the newest version, so it can in turn
+// be undone. Permissions deleted since that version make the rollback fail
+// rather than silently restoring a partial set.
+func (service *service) RollbackRole(ctx context.Context, roleID string, appID string, version int) (*model.Role, error) {
+	var role *model.Role
+	err := service.withTx(ctx, func(tx *sql.Tx) error {
+		// A deleted role must be restored first, so that its assignees do not
+		// quietly regain access through a rollback.
+		current, err := service.findRole(ctx, tx, roleID, appID)
+		if err != nil {
+			return err
+		}
+		if current == nil {
+			held, err := keyHeld(ctx, tx, roleVersionSQL, roleID, appID)
+			if err != nil {
+				return err
+			}
+			if held {
+				return isDeleted(model.EntityRole, roleID, appID)
+			}
+			return notFound(model.EntityRole, roleID, appID)
+		}
+
+		target, err := service.getRoleVersion(ctx, tx, roleID, appID, version)
+		if err != nil {
+			return err
+		}
+
+		restored := &model.Role{
+			ID:          target.RoleID,
+			AppID:       target.AppID,
+			Name:        target.Name,
+			Description: target.Description,
+			Permissions: make([]*model.Permission, 0, len(target.PermissionIDs)),
+		}
+		for _, permID := range target.PermissionIDs {
+			restored.Permissions = append(restored.Permissions, &model.Permission{ID: permID, AppID: target.AppID})
+		}
+		if err := service.writeRole(ctx, tx, restored, writeReplace, model.AuditActionRollback); err != nil {
+			return err
+		}
+
+		role, err = service.getRole(ctx, tx, roleID, appID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return role, nil
+}
@@ -0,0 +1,139 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"guardian/internal/filter"
+	"guardian/internal/model"
+)
+
+// Search matches a query against the ID, name and description of every
+// visible application, permission and role, and against usernames. A
+// document matches if it contains the query, is similar to it by trigrams,
+// or matches it as an English full-text query, so "refund" also finds
+// "Refunds". Roles containing a matching permission, and the applications
+// of matching permissions and roles, are returned too at half the rank.
+func (service *service) Search(ctx context.Context, query string, limit int) (*model.SearchResults, error) {
+	results := &model.SearchResults{Query: query}
+	args := []interface{}{query, "%" + filter.EscapeLike(query) + "%", limit}
+
+	var err error
+	if results.Permissions, err = service.searchHits(ctx, model.EntityPermission, searchPermsSQL, args); err != nil {
+		return nil, err
+	}
+	if results.Roles, err = service.searchHits(ctx, model.EntityRole, searchRolesSQL, args); err != nil {
+		return nil, err
+	}
+	if results.Applications, err = service.searchHits(ctx, model.EntityApplication, searchAppsSQL, args); err != nil {
+		return nil, err
+	}
+	if results.Users, err = service.searchHits(ctx, model.EntityUser, searchUsersSQL, args); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (service *service) searchHits(ctx context.Context, entity string, query string, args []interface{}) ([]*model.SearchHit, error) {
+	rows, err := service.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	hits := make([]*model.SearchHit, 0)
+	for rows.Next() {
+		hit := &model.SearchHit{Entity: entity}
+		if err := rows.Scan(&hit.ID, &hit.AppID, &hit.Name, &hit.Description, &hit.Rank, &hit.Via); err != nil {
+			return nil, err
+		}
+		hits = append(hits, hit)
+	}
+	return hits, rows.Err()
+}
+
+// searchDoc is the searched document of table. It must match the
+// expressions indexed by the search migration for the indexes to be used.
+func searchDoc(table string) string {
+	return fmt.Sprintf("(%[1]s.id || ' ' || %[1]s.name || ' ' || %[1]s.description)", table)
+}
+
+// searchMatch and searchRank take the query as $1 and a LIKE pattern
+// containing it as $2. An exact ID match ranks first.
+func searchMatch(doc string) string {
+	return fmt.Sprintf("(%[1]s ILIKE $2 OR $1 <%% %[1]s OR to_tsvector('english', %[1]s) @@ websearch_to_tsquery('english', $1))", doc)
+}
+
+func searchRank(table string) string {
+	doc := searchDoc(table)
+	return fmt.Sprintf("(word_similarity($1, %[1]s) + ts_rank(to_tsvector('english', %[1]s), websearch_to_tsquery('english', $1)) + CASE WHEN lower(%[2]s.id) = lower($1) THEN 1 ELSE 0 END)", doc, table)
+}
+
+var (
+	permHitsSQL = fmt.Sprintf(`
+		SELECT permissions.id, permissions.app_id, %s AS rank
+		FROM permissions
+		WHERE permissions.deleted_at IS NULL AND %s`,
+		searchRank("permissions"), searchMatch(searchDoc("permissions")))
+
+	roleHitsSQL = fmt.Sprintf(`
+		SELECT roles.id, roles.app_id, %s AS rank
+		FROM roles
+		WHERE roles.deleted_at IS NULL AND %s`,
+		searchRank("roles"), searchMatch(searchDoc("roles")))
+
+	searchPermsSQL = fmt.Sprintf(`
+	WITH hits AS (%s)
+	SELECT permissions.id, permissions.app_id, permissions.name, permissions.description, hits.rank, ''
+	FROM hits
+	JOIN permissions ON permissions.id = hits.id AND permissions.app_id = hits.app_id
+	ORDER BY hits.rank DESC, permissions.app_id, permissions.id
+	LIMIT $3
+	`, permHitsSQL)
+
+	// Each role keeps its best hit, direct or through a permission.
+	searchRolesSQL = fmt.Sprintf(`
+	WITH perm_hits AS (%s),
+	hits AS (
+		SELECT id, app_id, rank, '' AS via FROM (%s) AS direct
+		UNION ALL
+		SELECT role_permissions.role_id, role_permissions.app_id, perm_hits.rank / 2, 'permission ' || perm_hits.id
+		FROM perm_hits
+		JOIN role_permissions ON role_permissions.permission_id = perm_hits.id AND role_permissions.app_id = perm_hits.app_id
+	),
+	best AS (
+		SELECT DISTINCT ON (id, app_id) id, app_id, rank, via FROM hits ORDER BY id, app_id, rank DESC
+	)
+	SELECT roles.id, roles.app_id, roles.name, roles.description, best.rank, best.via
+	FROM best
+	JOIN roles ON roles.id = best.id AND roles.app_id = best.app_id AND roles.deleted_at IS NULL
+	ORDER BY best.rank DESC, roles.app_id, roles.id
+	LIMIT $3
+	`, permHitsSQL, roleHitsSQL)
+
+	searchAppsSQL = fmt.Sprintf(`
+	WITH hits AS (
+		SELECT applications.id, %s AS rank, '' AS via
+		FROM applications
+		WHERE applications.deleted_at IS NULL AND %s
+		UNION ALL
+		SELECT app_id, rank / 2, 'permission ' || id FROM (%s) AS perm_hits
+		UNION ALL
+		SELECT app_id, rank / 2, 'role ' || id FROM (%s) AS role_hits
+	),
+	best AS (
+		SELECT DISTINCT ON (id) id, rank, via FROM hits ORDER BY id, rank DESC
+	)
+	SELECT applications.id, '', applications.name, applications.description, best.rank, best.via
+	FROM best
+	JOIN applications ON applications.id = best.id AND applications.deleted_at IS NULL
+	ORDER BY best.rank DESC, applications.id
+	LIMIT $3
+	`, searchRank("applications"), searchMatch(searchDoc("applications")), permHitsSQL, roleHitsSQL)
+
+	searchUsersSQL = `
+	SELECT username, '', '', '', word_similarity($1, username) + CASE WHEN lower(username) = lower($1) THEN 1 ELSE 0 END AS rank, ''
+	FROM users
+	WHERE deleted_at IS NULL AND (username ILIKE $2 OR $1 <% username)
+	ORDER BY rank DESC, username
+	LIMIT $3
+	`
+)
@@ -0,0 +1,306 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"guardian/internal/filter"
+	"guardian/internal/model"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Applications, permissions, roles and users are deleted by stamping
+// deleted_at. Reads hide stamped rows, and rows hidden behind them (a role's
+// permissions, a user's roles) stay in place so a restore brings them back.
+// PurgeDeleted removes stamped rows for good once they pass retention.
+
+// missingRow reports a referenced row that does not exist or is deleted.
+func missingRow(err error, entity string, id string, appID string) error {
+	if err != nil {
+		return err
+	}
+	return &Error{
+		Kind:    ErrInvalidReference,
+		Code:    "invalid_reference",
+		Message: describe(entity, id, appID) + " does not exist",
+	}
+}
+
+func (service *service) requireApp(ctx context.Context, q querier, appID string) error {
+	if _, err := service.getApp(ctx, q, appID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return missingRow(nil, model.EntityApplication, appID, "")
+		}
+		return err
+	}
+	return nil
+}
+
+// syncAssignmentHistory keeps user_role_history in step with soft deletion,
+// which hides assignments without touching user_roles and so bypasses its
+// trigger. Open intervals whose assignment is now hidden are closed, and
+// visible assignments without an open interval get one. column scopes the
+// work to one app_id or username.
+func (service *service) syncAssignmentHistory(ctx context.Context, q querier, column string, value string) error {
+	const visible = `
+		SELECT
+			user_roles.username, user_roles.role_id, user_roles.app_id
+		FROM
+			user_roles
+		JOIN
+			users ON users.username = user_roles.username AND users.deleted_at IS NULL
+		JOIN
+			roles ON roles.id = user_roles.role_id AND roles.app_id = user_roles.app_id AND roles.deleted_at IS NULL
+	`
+	sql := fmt.Sprintf(`
+	UPDATE user_role_history SET valid_to = LOCALTIMESTAMP
+	WHERE valid_to IS NULL AND %[1]s = $1 AND (username, role_id, app_id) NOT IN (%[2]s WHERE user_roles.%[1]s = $1)
+	`, column, visible)
+	if _, err := q.ExecContext(ctx, sql, value); err != nil {
+		return err
+	}
+
+	sql = fmt.Sprintf(`
+	INSERT INTO user_role_history (username, role_id, app_id, valid_from)
+	SELECT visible.username, visible.role_id, visible.app_id, LOCALTIMESTAMP
+	FROM (%[2]s WHERE user_roles.%[1]s = $1) AS visible
+	WHERE NOT EXISTS (
+		SELECT 1 FROM user_role_history
+		WHERE user_role_history.username = visible.username
+			AND user_role_history.role_id = visible.role_id
+			AND user_role_history.app_id = visible.app_id
+			AND user_role_history.valid_to IS NULL
+	)
+	`, column, visible)
+	_, err := q.ExecContext(ctx, sql, value)
+	return err
+}
+
+// syncRoleVersions records a new revision for every role in appID whose
+// visible permission set no longer matches its latest revision, which
+// happens when permissions are deleted or restored underneath it.
+func (service *service) syncRoleVersions(ctx context.Context, q querier, appID string) error {
+	opts := &ListOptions{Filter: filter.Compare{Field: "app_id", Op: filter.Eq, Value: appID}}
+	roles, _, err := service.getRoles(ctx, q, opts)
+	if err != nil {
+		return err
+	}
+
+	query := "SELECT permission_ids FROM role_versions WHERE role_id = $1 AND app_id = $2 ORDER BY version DESC LIMIT 1"
+	for _, role := range roles {
+		current := make([]string, 0, len(role.Permissions))
+		for _, perm := range role.Permissions {
+			current = append(current, perm.ID)
+		}
+		sort.Strings(current)
+
+		var raw []byte
+		err := q.QueryRowContext(ctx, query, role.ID, role.AppID).Scan(&raw)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+		case err != nil:
+			return err
+		default:
+			var recorded []string
+			if err := json.Unmarshal(raw, &recorded); err != nil {
+				return err
+			}
+			if strings.Join(current, "\x00") == strings.Join(recorded, "\x00") {
+				continue
+			}
+		}
+		if _, err := q.ExecContext(ctx, "UPDATE roles SET version = version + 1 WHERE id = $1 AND app_id = $2", role.ID, role.AppID); err != nil {
+			return err
+		}
+		if err := service.recordRoleVersion(ctx, q, role); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deletedAt returns when a soft-deleted row was deleted, or sql.ErrNoRows if
+// the row does not exist or is not deleted.
+func deletedAt(ctx context.Context, q querier, query string, args ...interface{}) (time.Time, error) {
+	var t time.Time
+	err := q.QueryRowContext(ctx, query, args...).Scan(&t)
+	return t, err
+}
+
+// RestoreApp undeletes an application together with the permissions and
+// roles that were deleted along with it. Children deleted separately beforehand
+// stay deleted.
+func (service *service) RestoreApp(ctx context.Context, appID string) error {
+	return service.withTx(ctx, func(tx *sql.Tx) error {
+		if err := service.checkVersion(ctx, tx, appVersionSQL, appID); err != nil {
+			return err
+		}
+		at, err := deletedAt(ctx, tx, "SELECT deleted_at FROM applications WHERE id = $1 AND deleted_at IS NOT NULL FOR UPDATE", appID)
+		if err != nil {
+			return err
+		}
+
+		sql := "UPDATE applications SET deleted_at = NULL, version = version + 1 WHERE id = $1"
+		if _, err := tx.ExecContext(ctx, sql, appID); err != nil {
+			return err
+		}
+		for _, sql := range []string{
+			"UPDATE permissions SET deleted_at = NULL, version = version + 1 WHERE app_id = $1 AND deleted_at = $2",
+			"UPDATE roles SET deleted_at = NULL, version = version + 1 WHERE app_id = $1 AND deleted_at = $2",
+		} {
+			if _, err := tx.ExecContext(ctx, sql, appID, at); err != nil {
+				return err
+			}
+		}
+		if err := service.syncAssignmentHistory(ctx, tx, "app_id", appID); err != nil {
+			return err
+		}
+		if err := service.syncRoleVersions(ctx, tx, appID); err != nil {
+			return err
+		}
+
+		after, err := service.getApp(ctx, tx, appID)
+		if err != nil {
+			return err
+		}
+		return service.writeAudit(ctx, tx, model.AuditActionRestore, model.EntityApplication, appID, appID, nil, after)
+	})
+}
+
+func (service *service) RestorePerm(ctx context.Context, permID string, appID string) error {
+	return service.withTx(ctx, func(tx *sql.Tx) error {
+		if err := service.checkVersion(ctx, tx, permVersionSQL, permID, appID); err != nil {
+			return err
+		}
+		if _, err := deletedAt(ctx, tx, "SELECT deleted_at FROM permissions WHERE id = $1 AND app_id = $2 AND deleted_at IS NOT NULL FOR UPDATE", permID, appID); err != nil {
+			return err
+		}
+		if err := service.requireApp(ctx, tx, appID); err != nil {
+			return err
+		}
+
+		sql := "UPDATE permissions SET deleted_at = NULL, version = version + 1 WHERE id = $1 AND app_id = $2"
+		if _, err := tx.ExecContext(ctx, sql, permID, appID); err != nil {
+			return err
+		}
+		if err := service.syncRoleVersions(ctx, tx, appID); err != nil {
+			return err
+		}
+
+		after, err := service.getPerm(ctx, tx, permID, appID)
+		if err != nil {
+			return err
+		}
+		return service.writeAudit(ctx, tx, model.AuditActionRestore, model.EntityPermission, permID, appID, nil, after)
+	})
+}
+
+func (service *service) RestoreRole(ctx context.Context, roleID string, appID string) error {
+	return service.withTx(ctx, func(tx *sql.Tx) error {
+		if err := service.checkVersion(ctx, tx, roleVersionSQL, roleID, appID); err != nil {
+			return err
+		}
+		if _, err := deletedAt(ctx, tx, "SELECT deleted_at FROM roles WHERE id = $1 AND app_id = $2 AND deleted_at IS NOT NULL FOR UPDATE", roleID, appID); err != nil {
+			return err
+		}
+		if err := service.requireApp(ctx, tx, appID); err != nil {
+			return err
+		}
+
+		sql := "UPDATE roles SET deleted_at = NULL, version = version + 1 WHERE id = $1 AND app_id = $2"
+		if _, err := tx.ExecContext(ctx, sql, roleID, appID); err != nil {
+			return err
+		}
+		if err := service.syncAssignmentHistory(ctx, tx, "app_id", appID); err != nil {
+			return err
+		}
+		if err := service.syncRoleVersions(ctx, tx, appID); err != nil {
+			return err
+		}
+
+		after, err := service.getRole(ctx, tx, roleID, appID)
+		if err != nil {
+			return err
+		}
+		return service.writeAudit(ctx, tx, model.AuditActionRestore, model.EntityRole, roleID, appID, nil, after)
+	})
+}
+
+func (service *service) RestoreUser(ctx context.Context, userName string) error {
+	return service.withTx(ctx, func(tx *sql.Tx) error {
+		if err := service.checkVersion(ctx, tx, userVersionSQL, userName); err != nil {
+			return err
+		}
+		if _, err := deletedAt(ctx, tx, "SELECT deleted_at FROM users WHERE username = $1 AND deleted_at IS NOT NULL FOR UPDATE", userName); err != nil {
+			return err
+		}
+
+		sql := "UPDATE users SET deleted_at = NULL, updated_at = NOW(), version = version + 1 WHERE username = $1"
+		if _, err := tx.ExecContext(ctx, sql, userName); err != nil {
+			return err
+		}
+		if err := service.syncAssignmentHistory(ctx, tx, "username", userName); err != nil {
+			return err
+		}
+
+		after, err := service.getUser(ctx, tx, userName)
+		if err != nil {
+			return err
+		}
+		return service.writeAudit(ctx, tx, model.AuditActionRestore, model.EntityUser, userName, "", nil, after)
+	})
+}
+
+// PurgeDeleted permanently removes rows soft-deleted longer than retention
+// ago. Foreign key cascades take care of join rows and of children of purged
+// applications.
+func (service *service) PurgeDeleted(ctx context.Context, retention time.Duration) (*model.PurgeResult, error) {
+	result := new(model.PurgeResult)
+	err := service.withTx(ctx, func(tx *sql.Tx) error {
+		purges := []struct {
+			entity string
+			sql    string
+			count  *int64
+		}{
+			{model.EntityUser, "DELETE FROM users WHERE deleted_at < LOCALTIMESTAMP - make_interval(secs => $1) RETURNING username, ''", &result.Users},
+			{model.EntityRole, "DELETE FROM roles WHERE deleted_at < LOCALTIMESTAMP - make_interval(secs => $1) RETURNING id, app_id", &result.Roles},
+			{model.EntityPermission, "DELETE FROM permissions WHERE deleted_at < LOCALTIMESTAMP - make_interval(secs => $1) RETURNING id, app_id", &result.Permissions},
+			{model.EntityApplication, "DELETE FROM applications WHERE deleted_at < LOCALTIMESTAMP - make_interval(secs => $1) RETURNING id, id", &result.Applications},
+		}
+		for _, purge := range purges {
+			rows, err := tx.QueryContext(ctx, purge.sql, retention.Seconds())
+			if err != nil {
+				return err
+			}
+			var keys [][2]string
+			for rows.Next() {
+				var key [2]string
+				if err := rows.Scan(&key[0], &key[1]); err != nil {
+					rows.Close()
+					return err
+				}
+				keys = append(keys, key)
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return err
+			}
+
+			*purge.count = int64(len(keys))
+			for _, key := range keys {
+				if err := service.writeAudit(ctx, tx, model.AuditActionPurge, purge.entity, key[0], key[1], nil, nil); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
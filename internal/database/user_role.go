@@ -0,0 +1,90 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"guardian/internal/model"
+)
+
+// GrantUserRole assigns a single role to an existing user, leaving the
+// user's other assignments alone. It reports whether anything changed, so
+// granting a role the user already has is a successful no-op.
+func (service *service) GrantUserRole(ctx context.Context, userName string, roleID string, appID string) (bool, error) {
+	var changed bool
+	err := service.withTx(ctx, func(tx *sql.Tx) error {
+		if err := service.checkVersion(ctx, tx, userVersionSQL, userName); err != nil {
+			return err
+		}
+		before, err := service.getUser(ctx, tx, userName)
+		if err != nil {
+			return err
+		}
+
+		query := "INSERT INTO user_roles (username, role_id, app_id) SELECT $1, id, app_id FROM roles WHERE id = $2 AND app_id = $3 AND deleted_at IS NULL ON CONFLICT DO NOTHING"
+		res, err := tx.ExecContext(ctx, query, userName, roleID, appID)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			// Either the assignment already exists or the role does not.
+			if _, err := service.getRole(ctx, tx, roleID, appID); errors.Is(err, sql.ErrNoRows) {
+				return missingRow(nil, model.EntityRole, roleID, appID)
+			} else if err != nil {
+				return err
+			}
+			return nil
+		}
+
+		changed = true
+		return service.touchUser(ctx, tx, model.AuditActionGrant, before)
+	})
+	return changed, err
+}
+
+// RevokeUserRole removes a single role from a user. Revoking a role the user
+// does not have is a successful no-op.
+func (service *service) RevokeUserRole(ctx context.Context, userName string, roleID string, appID string) (bool, error) {
+	var changed bool
+	err := service.withTx(ctx, func(tx *sql.Tx) error {
+		if err := service.checkVersion(ctx, tx, userVersionSQL, userName); err != nil {
+			return err
+		}
+		before, err := service.getUser(ctx, tx, userName)
+		if err != nil {
+			return err
+		}
+
+		query := "DELETE FROM user_roles WHERE username = $1 AND role_id = $2 AND app_id = $3"
+		res, err := tx.ExecContext(ctx, query, userName, roleID, appID)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil || n == 0 {
+			return err
+		}
+
+		changed = true
+		return service.touchUser(ctx, tx, model.AuditActionRevoke, before)
+	})
+	return changed, err
+}
+
+// touchUser bumps a user's version and updated_at after its assignments
+// changed and records the change in the audit log.
+func (service *service) touchUser(ctx context.Context, tx *sql.Tx, action string, before *model.User) error {
+	sql := "UPDATE users SET updated_at = NOW(), version = version + 1 WHERE username = $1"
+	if _, err := tx.ExecContext(ctx, sql, before.UserName); err != nil {
+		return err
+	}
+	after, err := service.getUser(ctx, tx, before.UserName)
+	if err != nil {
+		return err
+	}
+	return service.writeAudit(ctx, tx, action, model.EntityUser, before.UserName, "", before, after)
+}
@@ -0,0 +1,204 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Values of UserView.Expand.
+const (
+	ExpandNone        = "none"
+	ExpandRoles       = "roles"
+	ExpandPermissions = "roles.permissions"
+)
+
+var (
+	userKeys       = []string{"username", "roles", "created_at", "updated_at", "version"}
+	roleKeys       = []string{"id", "app_id", "name", "description", "created_at", "permissions"}
+	permissionKeys = []string{"id", "app_id", "name", "description", "created_at"}
+)
+
+// UserView chooses how much GetUser and GetUsers return. Expand embeds no
+// roles, roles without their permissions, or (the default) roles with their
+// permissions. Fields, if set, is a sparse fieldset of user fields, role
+// fields prefixed "roles." and permission fields prefixed
+// "roles.permissions."; roles and permissions are only joined and
+// aggregated as far as the fieldset reaches into them.
+type UserView struct {
+	Expand string
+	Fields []string
+}
+
+func (view *UserView) expand() string {
+	if view == nil || view.Expand == "" {
+		return ExpandPermissions
+	}
+	return view.Expand
+}
+
+func (view *UserView) validate() error {
+	switch expand := view.expand(); expand {
+	case ExpandNone, ExpandRoles, ExpandPermissions:
+	default:
+		return &Error{Kind: ErrValidation, Code: "invalid_expand", Message: fmt.Sprintf("unknown expand %q", expand)}
+	}
+	if view == nil {
+		return nil
+	}
+	for _, field := range view.Fields {
+		known := contains(userKeys, field) ||
+			strings.HasPrefix(field, "roles.") && contains(roleKeys, strings.TrimPrefix(field, "roles.")) ||
+			strings.HasPrefix(field, "roles.permissions.") && contains(permissionKeys, strings.TrimPrefix(field, "roles.permissions."))
+		if !known {
+			return &Error{Kind: ErrValidation, Code: "invalid_fields", Message: fmt.Sprintf("unknown field %q", field)}
+		}
+		if !view.reaches(field) {
+			return &Error{Kind: ErrValidation, Code: "invalid_fields", Message: fmt.Sprintf("field %q is not expanded", field)}
+		}
+	}
+	return nil
+}
+
+// reaches reports whether path lies within what Expand embeds.
+func (view *UserView) reaches(path string) bool {
+	switch view.expand() {
+	case ExpandNone:
+		return path != "roles" && !strings.HasPrefix(path, "roles.")
+	case ExpandRoles:
+		return path != "roles.permissions" && !strings.HasPrefix(path, "roles.permissions.")
+	}
+	return true
+}
+
+// selects reports whether the fieldset asks for path or anything in it.
+func (view *UserView) selects(path string) bool {
+	if !view.reaches(path) {
+		return false
+	}
+	if view == nil || len(view.Fields) == 0 {
+		return true
+	}
+	for _, field := range view.Fields {
+		if field == path || strings.HasPrefix(field, path+".") || strings.HasPrefix(path, field+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// keys returns the fields of the object at prefix that the view selects.
+func (view *UserView) keys(prefix string, all []string) []string {
+	keys := make([]string, 0, len(all))
+	for _, key := range all {
+		if view.selects(prefix + key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Paths returns the fields the view selects for rendering, or nil if it
+// selects everything.
+func (view *UserView) Paths() []string {
+	if view.expand() == ExpandPermissions && (view == nil || len(view.Fields) == 0) {
+		return nil
+	}
+	if view != nil && len(view.Fields) > 0 {
+		return view.Fields
+	}
+	var paths []string
+	for _, key := range view.keys("", userKeys) {
+		if key == "roles" {
+			for _, key := range view.keys("roles.", roleKeys) {
+				paths = append(paths, "roles."+key)
+			}
+			continue
+		}
+		paths = append(paths, key)
+	}
+	return paths
+}
+
+// jsonObject builds a json_build_object over keys of table, with timestamps
+// rendered as text the way model.Timestamp reads them. The permissions key
+// refers to an aggregate column of table.
+func jsonObject(table string, keys []string) string {
+	args := make([]string, 0, 2*len(keys))
+	for _, key := range keys {
+		col := table + "." + key
+		if key == "created_at" {
+			col += "::text"
+		}
+		args = append(args, "'"+key+"'", col)
+	}
+	return "json_build_object(" + strings.Join(args, ", ") + ")"
+}
+
+// usersSQL selects the users in the CTE page, with their roles aggregated as
+// far as view asks. The roles column is NULL when roles are not selected.
+func usersSQL(view *UserView) string {
+	if !view.selects("roles") {
+		return `
+	SELECT page.username, page.created_at, page.updated_at, page.version, NULL AS roles
+	FROM page
+	`
+	}
+
+	roleCols := []string{"roles.id", "roles.app_id"}
+	for _, key := range []string{"name", "description", "created_at"} {
+		if view.selects("roles." + key) {
+			roleCols = append(roleCols, "roles."+key)
+		}
+	}
+	permJoin := ""
+	if view.selects("roles.permissions") {
+		roleCols = append(roleCols, fmt.Sprintf(
+			"COALESCE(json_agg(%s) FILTER (WHERE permissions.id IS NOT NULL), '[]') AS permissions",
+			jsonObject("permissions", view.keys("roles.permissions.", permissionKeys)),
+		))
+		permJoin = `
+			LEFT JOIN
+				role_permissions ON roles.id = role_permissions.role_id AND roles.app_id = role_permissions.app_id
+			LEFT JOIN
+				permissions ON permissions.id = role_permissions.permission_id AND permissions.app_id = role_permissions.app_id AND permissions.deleted_at IS NULL`
+	}
+	group := roleCols
+	if permJoin != "" {
+		group = roleCols[:len(roleCols)-1]
+	}
+
+	return fmt.Sprintf(`
+	SELECT
+		page.username,
+		page.created_at,
+		page.updated_at,
+		page.version,
+	COALESCE(json_agg(%s) FILTER (WHERE roles.id IS NOT NULL), '[]') AS roles
+	FROM
+		page
+	LEFT JOIN
+		user_roles
+	ON
+		page.username = user_roles.username
+	LEFT JOIN
+		(
+			SELECT
+				%s
+			FROM
+				roles%s
+			WHERE
+				roles.deleted_at IS NULL AND (roles.id, roles.app_id) IN (SELECT role_id, app_id FROM user_roles WHERE username IN (SELECT username FROM page))
+			GROUP BY
+				%s
+		) AS roles
+	ON
+		user_roles.role_id = roles.id AND user_roles.app_id = roles.app_id
+	GROUP BY
+		page.username, page.created_at, page.updated_at, page.version
+	`,
+		jsonObject("roles", view.keys("roles.", roleKeys)),
+		strings.Join(roleCols, ",\n\t\t\t\t"),
+		permJoin,
+		strings.Join(group, ", "),
+	)
+}
@@ -0,0 +1,48 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// ErrPreconditionFailed is returned by writes whose expected version, set
+// with WithExpectedVersion, no longer matches the stored entity.
+var ErrPreconditionFailed = errors.New("precondition failed")
+
+type expectedVersionKey struct{}
+
+// WithExpectedVersion makes the next write to an entity fail with
+// ErrPreconditionFailed unless the entity is stored at exactly version.
+func WithExpectedVersion(ctx context.Context, version int) context.Context {
+	return context.WithValue(ctx, expectedVersionKey{}, version)
+}
+
+// withoutExpectedVersion drops the expected version from ctx. Bulk writes
+// touch many entities, none of which a single If-Match can name.
+func withoutExpectedVersion(ctx context.Context) context.Context {
+	return context.WithValue(ctx, expectedVersionKey{}, nil)
+}
+
+const (
+	appVersionSQL  = "SELECT version FROM applications WHERE id = $1 FOR UPDATE"
+	permVersionSQL = "SELECT version FROM permissions WHERE id = $1 AND app_id = $2 FOR UPDATE"
+	roleVersionSQL = "SELECT version FROM roles WHERE id = $1 AND app_id = $2 FOR UPDATE"
+	userVersionSQL = "SELECT version FROM users WHERE username = $1 FOR UPDATE"
+)
+
+// checkVersion locks the entity selected by query and compares its version
+// with the one expected by ctx, if any. A missing entity never matches.
+func (service *service) checkVersion(ctx context.Context, q querier, query string, args ...interface{}) error {
+	expected, ok := ctx.Value(expectedVersionKey{}).(int)
+	if !ok {
+		return nil
+	}
+
+	var version int
+	err := q.QueryRowContext(ctx, query, args...).Scan(&version)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && version != expected) {
+		return ErrPreconditionFailed
+	}
+	return err
+}
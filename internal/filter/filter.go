@@ -0,0 +1,93 @@
+// Package filter parses SCIM filter expressions (RFC 7644, section 3.4.2.2)
+// such as
+//
+//	app_id eq "crm" and (name sw "admin" or not (description pr))
+//
+// and compiles them into parameterized SQL conditions over an allowlist of
+// fields.
+package filter
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Op is a comparison operator.
+type Op string
+
+const (
+	Eq Op = "eq"
+	Ne Op = "ne"
+	Co Op = "co"
+	Sw Op = "sw"
+	Ew Op = "ew"
+	Gt Op = "gt"
+	Ge Op = "ge"
+	Lt Op = "lt"
+	Le Op = "le"
+	Pr Op = "pr"
+)
+
+var ops = map[string]Op{"eq": Eq, "ne": Ne, "co": Co, "sw": Sw, "ew": Ew, "gt": Gt, "ge": Ge, "lt": Lt, "le": Le, "pr": Pr}
+
+// Expr is a parsed filter: a Compare, And, Or or Not.
+type Expr interface {
+	String() string
+}
+
+// Compare tests a field against Value, which is a string, float64, bool or
+// nil. Value is unused for Pr.
+type Compare struct {
+	Field string
+	Op    Op
+	Value interface{}
+}
+
+type And []Expr
+
+type Or []Expr
+
+type Not struct {
+	Expr Expr
+}
+
+func (c Compare) String() string {
+	if c.Op == Pr {
+		return c.Field + " pr"
+	}
+	value, _ := json.Marshal(c.Value)
+	return fmt.Sprintf("%s %s %s", c.Field, c.Op, value)
+}
+
+func (a And) String() string { return join(a, " and ") }
+
+func (o Or) String() string { return join(o, " or ") }
+
+func (n Not) String() string { return "not (" + n.Expr.String() + ")" }
+
+func join(exprs []Expr, sep string) string {
+	parts := make([]string, 0, len(exprs))
+	for _, expr := range exprs {
+		parts = append(parts, "("+expr.String()+")")
+	}
+	return strings.Join(parts, sep)
+}
+
+// All joins exprs with "and", skipping nil ones. It returns nil if none is
+// left, which matches everything.
+func All(exprs ...Expr) Expr {
+	var and And
+	for _, expr := range exprs {
+		if expr != nil {
+			and = append(and, expr)
+		}
+	}
+	switch len(and) {
+	case 0:
+		return nil
+	case 1:
+		return and[0]
+	}
+	return and
+}
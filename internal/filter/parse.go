@@ -0,0 +1,250 @@
+package filter
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	// MaxLength bounds the size of a filter expression.
+	MaxLength = 4096
+	maxDepth  = 32
+)
+
+// SyntaxError reports a malformed filter. Pos is the byte offset at which
+// parsing failed.
+type SyntaxError struct {
+	Pos int
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("invalid filter at position %d: %s", e.Pos, e.Msg)
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokWord
+	tokString
+	tokNumber
+	tokLParen
+	tokRParen
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+type parser struct {
+	src   string
+	pos   int
+	tok   token
+	depth int
+}
+
+// Parse parses a SCIM filter expression. Operators and the keywords and,
+// or, not, true, false and null are case-insensitive; field names are
+// returned as written.
+func Parse(src string) (Expr, error) {
+	if len(src) > MaxLength {
+		return nil, &SyntaxError{Pos: MaxLength, Msg: fmt.Sprintf("longer than %d bytes", MaxLength)}
+	}
+	p := &parser{src: src}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	expr, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("unexpected %q", p.tok.text)
+	}
+	return expr, nil
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return &SyntaxError{Pos: p.tok.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) next() error {
+	for p.pos < len(p.src) && unicode.IsSpace(rune(p.src[p.pos])) {
+		p.pos++
+	}
+	start := p.pos
+	if p.pos == len(p.src) {
+		p.tok = token{kind: tokEOF, text: "end of filter", pos: start}
+		return nil
+	}
+
+	switch ch := p.src[p.pos]; {
+	case ch == '(':
+		p.pos++
+		p.tok = token{kind: tokLParen, text: "(", pos: start}
+	case ch == ')':
+		p.pos++
+		p.tok = token{kind: tokRParen, text: ")", pos: start}
+	case ch == '"':
+		p.pos++
+		for p.pos < len(p.src) && p.src[p.pos] != '"' {
+			if p.src[p.pos] == '\\' {
+				p.pos++
+			}
+			p.pos++
+		}
+		if p.pos >= len(p.src) {
+			return &SyntaxError{Pos: start, Msg: "unterminated string"}
+		}
+		p.pos++
+		var s string
+		if err := json.Unmarshal([]byte(p.src[start:p.pos]), &s); err != nil {
+			return &SyntaxError{Pos: start, Msg: "invalid string " + p.src[start:p.pos]}
+		}
+		p.tok = token{kind: tokString, text: s, pos: start}
+	case ch == '-' || ch >= '0' && ch <= '9':
+		for p.pos < len(p.src) && strings.IndexByte("+-.eE0123456789", p.src[p.pos]) >= 0 {
+			p.pos++
+		}
+		p.tok = token{kind: tokNumber, text: p.src[start:p.pos], pos: start}
+	case isWordByte(ch):
+		for p.pos < len(p.src) && isWordByte(p.src[p.pos]) {
+			p.pos++
+		}
+		p.tok = token{kind: tokWord, text: p.src[start:p.pos], pos: start}
+	default:
+		return &SyntaxError{Pos: start, Msg: fmt.Sprintf("unexpected character %q", ch)}
+	}
+	return nil
+}
+
+func isWordByte(ch byte) bool {
+	return ch == '_' || ch == '.' || ch == '$' || ch == '-' ||
+		ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9'
+}
+
+func (p *parser) keyword(word string) bool {
+	return p.tok.kind == tokWord && strings.EqualFold(p.tok.text, word)
+}
+
+func (p *parser) or() (Expr, error) {
+	expr, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	or := Or{expr}
+	for p.keyword("or") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		expr, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		or = append(or, expr)
+	}
+	if len(or) == 1 {
+		return or[0], nil
+	}
+	return or, nil
+}
+
+func (p *parser) and() (Expr, error) {
+	expr, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	and := And{expr}
+	for p.keyword("and") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		expr, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		and = append(and, expr)
+	}
+	if len(and) == 1 {
+		return and[0], nil
+	}
+	return and, nil
+}
+
+func (p *parser) unary() (Expr, error) {
+	if p.depth++; p.depth > maxDepth {
+		return nil, p.errorf("nested deeper than %d levels", maxDepth)
+	}
+	defer func() { p.depth-- }()
+
+	switch {
+	case p.keyword("not"):
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		expr, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return Not{Expr: expr}, nil
+	case p.tok.kind == tokLParen:
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		expr, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok.kind != tokRParen {
+			return nil, p.errorf("expected \")\", found %q", p.tok.text)
+		}
+		return expr, p.next()
+	}
+	return p.compare()
+}
+
+func (p *parser) compare() (Expr, error) {
+	if p.tok.kind != tokWord {
+		return nil, p.errorf("expected a field name, found %q", p.tok.text)
+	}
+	field := p.tok.text
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+
+	op, ok := ops[strings.ToLower(p.tok.text)]
+	if p.tok.kind != tokWord || !ok {
+		return nil, p.errorf("expected an operator after %s, found %q", field, p.tok.text)
+	}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	if op == Pr {
+		return Compare{Field: field, Op: Pr}, nil
+	}
+
+	var value interface{}
+	switch {
+	case p.tok.kind == tokString:
+		value = p.tok.text
+	case p.tok.kind == tokNumber:
+		n, err := strconv.ParseFloat(p.tok.text, 64)
+		if err != nil {
+			return nil, p.errorf("invalid number %s", p.tok.text)
+		}
+		value = n
+	case p.keyword("true"), p.keyword("false"):
+		value = strings.EqualFold(p.tok.text, "true")
+	case p.keyword("null"):
+		value = nil
+	default:
+		return nil, p.errorf("expected a value after %s %s, found %q", field, op, p.tok.text)
+	}
+	return Compare{Field: field, Op: op, Value: value}, p.next()
+}
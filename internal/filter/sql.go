@@ -0,0 +1,218 @@
+package filter
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Kind is the type of a filterable field, which decides the operators and
+// values it accepts.
+type Kind int
+
+const (
+	String Kind = iota
+	Int
+	Time
+)
+
+// Field maps a filter field onto SQL. Column is the column or expression
+// compared. A multi-valued field sets Exists to a subquery, written up to
+// its WHERE clause and ending in AND, that selects the values of the row;
+// the field then matches if any of them does.
+type Field struct {
+	Column string
+	Kind   Kind
+	Exists string
+}
+
+// Fields is the allowlist of fields a filter may refer to, keyed by name.
+type Fields map[string]Field
+
+// FieldError reports a filter that refers to a field outside the allowlist
+// or compares it in a way its kind does not support.
+type FieldError struct {
+	Field string
+	Msg   string
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("filter field %s: %s", e.Field, e.Msg)
+}
+
+// timeLayouts are the time formats accepted for Time fields, after
+// RFC 3339; they are read in the server's local time zone.
+var timeLayouts = []string{"2006-01-02 15:04:05", "2006-01-02"}
+
+// SQL compiles expr into a condition with "?" placeholders and the values
+// to bind to them. A nil expr compiles to "TRUE".
+func (fields Fields) SQL(expr Expr) (string, []interface{}, error) {
+	if expr == nil {
+		return "TRUE", nil, nil
+	}
+	var vals []interface{}
+	cond, err := fields.compile(expr, &vals)
+	return cond, vals, err
+}
+
+// Names returns the allowed field names in order.
+func (fields Fields) Names() []string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (fields Fields) compile(expr Expr, vals *[]interface{}) (string, error) {
+	switch expr := expr.(type) {
+	case And:
+		return fields.compileAll(expr, " AND ", vals)
+	case Or:
+		return fields.compileAll(expr, " OR ", vals)
+	case Not:
+		cond, err := fields.compile(expr.Expr, vals)
+		if err != nil {
+			return "", err
+		}
+		return "NOT (" + cond + ")", nil
+	case Compare:
+		return fields.compare(expr, vals)
+	}
+	return "", fmt.Errorf("filter: unsupported expression %T", expr)
+}
+
+func (fields Fields) compileAll(exprs []Expr, sep string, vals *[]interface{}) (string, error) {
+	conds := make([]string, 0, len(exprs))
+	for _, expr := range exprs {
+		cond, err := fields.compile(expr, vals)
+		if err != nil {
+			return "", err
+		}
+		conds = append(conds, "("+cond+")")
+	}
+	return strings.Join(conds, sep), nil
+}
+
+// lookup finds a field by name, ignoring case as SCIM attribute names do.
+func (fields Fields) lookup(name string) (Field, bool) {
+	if field, ok := fields[name]; ok {
+		return field, true
+	}
+	for n, field := range fields {
+		if strings.EqualFold(n, name) {
+			return field, true
+		}
+	}
+	return Field{}, false
+}
+
+var compareSQL = map[Op]string{Eq: "=", Ne: "<>", Gt: ">", Ge: ">=", Lt: "<", Le: "<="}
+
+func (fields Fields) compare(c Compare, vals *[]interface{}) (string, error) {
+	field, ok := fields.lookup(c.Field)
+	if !ok {
+		return "", &FieldError{Field: c.Field, Msg: "unknown field, use one of " + strings.Join(fields.Names(), ", ")}
+	}
+
+	var cond string
+	switch {
+	case c.Op == Pr:
+		cond = field.Column + " IS NOT NULL"
+		if field.Kind == String {
+			cond += " AND " + field.Column + " <> ''"
+		}
+	case c.Value == nil:
+		// Every filterable column is NOT NULL, so only the negation of
+		// "eq null" can hold.
+		if c.Op != Eq && c.Op != Ne {
+			return "", &FieldError{Field: c.Field, Msg: fmt.Sprintf("%s cannot compare with null", c.Op)}
+		}
+		cond = field.Column + " IS NULL"
+		if c.Op == Ne {
+			cond = field.Column + " IS NOT NULL"
+		}
+	default:
+		var err error
+		if cond, err = field.compare(c, vals); err != nil {
+			return "", err
+		}
+	}
+
+	if field.Exists != "" {
+		return "EXISTS (" + field.Exists + " " + cond + ")", nil
+	}
+	return cond, nil
+}
+
+func (field Field) compare(c Compare, vals *[]interface{}) (string, error) {
+	switch field.Kind {
+	case String:
+		s, ok := c.Value.(string)
+		if !ok {
+			return "", &FieldError{Field: c.Field, Msg: "expects a string"}
+		}
+		switch c.Op {
+		case Co, Sw, Ew:
+			pattern := EscapeLike(s)
+			if c.Op != Sw {
+				pattern = "%" + pattern
+			}
+			if c.Op != Ew {
+				pattern += "%"
+			}
+			*vals = append(*vals, pattern)
+			return field.Column + " LIKE ?", nil
+		}
+		*vals = append(*vals, s)
+		return field.Column + " " + compareSQL[c.Op] + " ?", nil
+
+	case Int:
+		n, ok := c.Value.(float64)
+		if !ok || n != math.Trunc(n) || math.Abs(n) > 1<<53 {
+			return "", &FieldError{Field: c.Field, Msg: "expects an integer"}
+		}
+		if _, ok := compareSQL[c.Op]; !ok {
+			return "", &FieldError{Field: c.Field, Msg: fmt.Sprintf("does not support %s", c.Op)}
+		}
+		*vals = append(*vals, int64(n))
+		return field.Column + " " + compareSQL[c.Op] + " ?", nil
+
+	case Time:
+		s, ok := c.Value.(string)
+		if !ok {
+			return "", &FieldError{Field: c.Field, Msg: "expects a time string"}
+		}
+		t, err := parseTime(s)
+		if err != nil {
+			return "", &FieldError{Field: c.Field, Msg: fmt.Sprintf("invalid time %q", s)}
+		}
+		if _, ok := compareSQL[c.Op]; !ok {
+			return "", &FieldError{Field: c.Field, Msg: fmt.Sprintf("does not support %s", c.Op)}
+		}
+		*vals = append(*vals, t)
+		return field.Column + " " + compareSQL[c.Op] + " CAST(?::timestamptz AS TIMESTAMP)", nil
+	}
+	return "", fmt.Errorf("filter: field %s has unknown kind %d", c.Field, field.Kind)
+}
+
+func parseTime(s string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err == nil {
+		return t, nil
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+// EscapeLike quotes the LIKE wildcards in s.
+func EscapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,327 @@
+// Package keycloak maps a Keycloak realm export onto Guardian's model.
+//
+// Clients become applications and client roles become roles. Guardian has
+// no role hierarchy, so composite roles are flattened: every non-composite
+// client role also becomes a permission, granted by its own role and by
+// every composite role that reaches it. Users keep the client roles mapped
+// to them directly and through their groups. Realm roles belong to no
+// client and have no equivalent.
+package keycloak
+
+import (
+	"fmt"
+	"guardian/internal/model"
+	"guardian/internal/validation"
+	"sort"
+	"strings"
+)
+
+// Realm is the part of a realm export the mapping reads.
+type Realm struct {
+	Realm   string   `json:"realm"`
+	Clients []Client `json:"clients"`
+	Roles   struct {
+		Realm  []Role            `json:"realm"`
+		Client map[string][]Role `json:"client"`
+	} `json:"roles"`
+	Groups []Group `json:"groups"`
+	Users  []User  `json:"users"`
+}
+
+type Client struct {
+	ClientID    string `json:"clientId"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type Role struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Composite   bool   `json:"composite"`
+	Composites  *struct {
+		Realm  []string            `json:"realm"`
+		Client map[string][]string `json:"client"`
+	} `json:"composites"`
+}
+
+type Group struct {
+	Name        string              `json:"name"`
+	Path        string              `json:"path"`
+	RealmRoles  []string            `json:"realmRoles"`
+	ClientRoles map[string][]string `json:"clientRoles"`
+	SubGroups   []Group             `json:"subGroups"`
+}
+
+type User struct {
+	Username    string              `json:"username"`
+	RealmRoles  []string            `json:"realmRoles"`
+	ClientRoles map[string][]string `json:"clientRoles"`
+	Groups      []string            `json:"groups"`
+}
+
+// builtinClients are created by Keycloak in every realm and only matter to
+// Keycloak itself.
+var builtinClients = map[string]bool{
+	"account":                true,
+	"account-console":        true,
+	"admin-cli":              true,
+	"broker":                 true,
+	"realm-management":       true,
+	"security-admin-console": true,
+}
+
+// Mapping kinds.
+const (
+	KindClient     = "client"
+	KindClientRole = "client_role"
+	KindRealmRole  = "realm_role"
+	KindGroup      = "group"
+	KindUser       = "user"
+)
+
+type mapper struct {
+	realm  *Realm
+	report *model.KeycloakReport
+	// roles holds the mapped role IDs of each mapped client.
+	roles map[string]map[string]bool
+}
+
+func (m *mapper) mapped(kind, source, target, note string) {
+	m.report.Mapped = append(m.report.Mapped, &model.KeycloakMapping{Kind: kind, Source: source, Target: target, Note: note})
+}
+
+func (m *mapper) skipped(kind, source, note string) {
+	m.report.Skipped = append(m.report.Skipped, &model.KeycloakMapping{Kind: kind, Source: source, Note: note})
+}
+
+// Map maps realm onto Guardian and reports every client, client role and
+// realm role, and every group or user it could not map.
+func Map(realm *Realm) *model.KeycloakImport {
+	m := &mapper{
+		realm: realm,
+		report: &model.KeycloakReport{
+			Realm:   realm.Realm,
+			Mapped:  make([]*model.KeycloakMapping, 0),
+			Skipped: make([]*model.KeycloakMapping, 0),
+		},
+		roles: make(map[string]map[string]bool),
+	}
+	imp := &model.KeycloakImport{
+		Manifests:   make([]*model.Manifest, 0),
+		Users:       make([]string, 0),
+		Assignments: make([]*model.Assignment, 0),
+		Report:      m.report,
+	}
+
+	for _, client := range realm.Clients {
+		if manifest := m.mapClient(client); manifest != nil {
+			imp.Manifests = append(imp.Manifests, manifest)
+		}
+	}
+	for _, role := range realm.Roles.Realm {
+		m.skipped(KindRealmRole, role.Name, "realm roles belong to no client; their mappings are dropped")
+	}
+
+	groupRoles := make(map[string]map[string][]string)
+	for _, group := range realm.Groups {
+		m.mapGroup(group, "", nil, groupRoles)
+	}
+	for _, user := range realm.Users {
+		assignments, ok := m.mapUser(user, groupRoles)
+		if !ok {
+			continue
+		}
+		imp.Users = append(imp.Users, user.Username)
+		imp.Assignments = append(imp.Assignments, assignments...)
+	}
+	m.report.Users = len(imp.Users)
+	m.report.Assignments = len(imp.Assignments)
+	return imp
+}
+
+func (m *mapper) mapClient(client Client) *model.Manifest {
+	if builtinClients[client.ClientID] {
+		m.skipped(KindClient, client.ClientID, "built-in Keycloak client")
+		return nil
+	}
+	app := &model.Application{ID: client.ClientID, Name: client.Name, Description: client.Description}
+	if app.Name == "" {
+		app.Name = app.ID
+	}
+	if err := validation.Application(app); err != nil {
+		m.skipped(KindClient, client.ClientID, err.Error())
+		return nil
+	}
+	m.mapped(KindClient, client.ClientID, "application "+app.ID, "")
+
+	manifest := &model.Manifest{
+		Version:     model.ManifestVersion,
+		Application: model.ManifestApplication{ID: app.ID, Name: app.Name, Description: app.Description},
+		Permissions: make([]*model.ManifestPermission, 0),
+		Roles:       make([]*model.ManifestRole, 0),
+	}
+	roles := m.realm.Roles.Client[client.ClientID]
+	byName := make(map[string]*Role, len(roles))
+	for i := range roles {
+		byName[roles[i].Name] = &roles[i]
+	}
+
+	// Leaves become permissions first, so composites can tell which of
+	// their leaves survived.
+	perms := make(map[string]bool)
+	for _, role := range roles {
+		if role.Composite {
+			continue
+		}
+		perm := &model.Permission{ID: role.Name, AppID: app.ID, Name: role.Name, Description: role.Description}
+		if err := validation.Permission(perm); err != nil {
+			m.skipped(KindClientRole, client.ClientID+"/"+role.Name, err.Error())
+			continue
+		}
+		perms[perm.ID] = true
+		manifest.Permissions = append(manifest.Permissions, &model.ManifestPermission{ID: perm.ID, Name: perm.Name, Description: perm.Description})
+	}
+
+	m.roles[app.ID] = make(map[string]bool)
+	for _, role := range roles {
+		if !role.Composite && !perms[role.Name] {
+			continue
+		}
+		source := client.ClientID + "/" + role.Name
+		leaves, foreign := flatten(client.ClientID, &role, byName)
+		ids := make([]string, 0, len(leaves))
+		for _, leaf := range leaves {
+			if perms[leaf] {
+				ids = append(ids, leaf)
+			}
+		}
+		r := &model.Role{ID: role.Name, AppID: app.ID, Name: role.Name, Description: role.Description}
+		if err := validation.Role(r); err != nil {
+			m.skipped(KindClientRole, source, err.Error())
+			continue
+		}
+		m.roles[app.ID][r.ID] = true
+		manifest.Roles = append(manifest.Roles, &model.ManifestRole{ID: r.ID, Name: r.Name, Description: r.Description, Permissions: ids})
+
+		note := ""
+		if role.Composite {
+			note = "composite flattened into permissions " + strings.Join(ids, ", ")
+			if len(ids) == 0 {
+				note = "composite with no mappable permissions"
+			}
+		}
+		if len(foreign) > 0 {
+			note = strings.TrimPrefix(note+"; dropped composites outside the client: "+strings.Join(foreign, ", "), "; ")
+		}
+		target := fmt.Sprintf("role %s of application %s", r.ID, app.ID)
+		if !role.Composite {
+			target += " granting permission " + r.ID
+		}
+		m.mapped(KindClientRole, source, target, note)
+	}
+
+	sort.Slice(manifest.Permissions, func(i, j int) bool { return manifest.Permissions[i].ID < manifest.Permissions[j].ID })
+	sort.Slice(manifest.Roles, func(i, j int) bool { return manifest.Roles[i].ID < manifest.Roles[j].ID })
+	return manifest
+}
+
+// flatten returns the sorted non-composite roles of clientID that role
+// reaches, itself included if it is not composite, and the composites it
+// names outside the client.
+func flatten(clientID string, role *Role, byName map[string]*Role) ([]string, []string) {
+	var leaves, foreign []string
+	seen := make(map[string]bool)
+	var walk func(role *Role)
+	walk = func(role *Role) {
+		if seen[role.Name] {
+			return
+		}
+		seen[role.Name] = true
+		if !role.Composite {
+			leaves = append(leaves, role.Name)
+			return
+		}
+		if role.Composites == nil {
+			return
+		}
+		for _, name := range role.Composites.Realm {
+			foreign = append(foreign, "realm role "+name)
+		}
+		for client, names := range role.Composites.Client {
+			for _, name := range names {
+				if client != clientID {
+					foreign = append(foreign, client+"/"+name)
+					continue
+				}
+				if child := byName[name]; child != nil {
+					walk(child)
+				}
+			}
+		}
+	}
+	walk(role)
+	sort.Strings(leaves)
+	sort.Strings(foreign)
+	return leaves, foreign
+}
+
+// mapGroup records the client roles each group path grants, subgroups
+// inheriting those of their parents. Exports that omit a path get one built
+// under parent, the path of the enclosing group.
+func (m *mapper) mapGroup(group Group, parent string, inherited map[string][]string, groupRoles map[string]map[string][]string) {
+	path := group.Path
+	if path == "" {
+		path = parent + "/" + group.Name
+	}
+	roles := make(map[string][]string, len(inherited)+len(group.ClientRoles))
+	for client, names := range inherited {
+		roles[client] = append(roles[client], names...)
+	}
+	for client, names := range group.ClientRoles {
+		roles[client] = append(roles[client], names...)
+	}
+	groupRoles[path] = roles
+	if len(group.RealmRoles) > 0 {
+		m.skipped(KindGroup, path, "realm roles of the group are dropped: "+strings.Join(group.RealmRoles, ", "))
+	}
+	for _, sub := range group.SubGroups {
+		m.mapGroup(sub, path, roles, groupRoles)
+	}
+}
+
+// mapUser returns the assignments of a user, or false if the user is not
+// imported at all.
+func (m *mapper) mapUser(user User, groupRoles map[string]map[string][]string) ([]*model.Assignment, bool) {
+	if strings.HasPrefix(user.Username, "service-account-") {
+		m.skipped(KindUser, user.Username, "service account of a client")
+		return nil, false
+	}
+	if err := validation.User(&model.User{UserName: user.Username}); err != nil {
+		m.skipped(KindUser, user.Username, err.Error())
+		return nil, false
+	}
+
+	sources := []map[string][]string{user.ClientRoles}
+	for _, path := range user.Groups {
+		sources = append(sources, groupRoles[path])
+	}
+	seen := make(map[[2]string]bool)
+	assignments := make([]*model.Assignment, 0)
+	for _, source := range sources {
+		for client, names := range source {
+			for _, name := range names {
+				key := [2]string{client, name}
+				if seen[key] || !m.roles[client][name] {
+					continue
+				}
+				seen[key] = true
+				assignments = append(assignments, &model.Assignment{UserName: user.Username, AppID: client, RoleID: name})
+			}
+		}
+	}
+	sort.Slice(assignments, func(i, j int) bool {
+		a, b := assignments[i], assignments[j]
+		return a.AppID < b.AppID || a.AppID == b.AppID && a.RoleID < b.RoleID
+	})
+	return assignments, true
+}
@@ -0,0 +1,19 @@
+package model
+
+// EffectivePermission is a permission a user holds through one or more of
+// their roles.
+type EffectivePermission struct {
+	AppID        string   `json:"app_id"`
+	PermissionID string   `json:"permission_id"`
+	Name         string   `json:"name"`
+	Description  string   `json:"description"`
+	Roles        []string `json:"roles"`
+}
+
+type Decision struct {
+	UserName     string   `json:"username"`
+	AppID        string   `json:"app_id"`
+	PermissionID string   `json:"permission_id"`
+	Allowed      bool     `json:"allowed"`
+	Roles        []string `json:"roles"`
+}
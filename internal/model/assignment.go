@@ -0,0 +1,58 @@
+package model
+
+// Assignment import modes. Add only grants; replace also revokes, from the
+// users the import lists, whatever it does not list for them; sync revokes
+// everything not listed from every user.
+const (
+	ImportAdd     = "add"
+	ImportReplace = "replace"
+	ImportSync    = "sync"
+)
+
+// Assignment is a role granted to a user.
+type Assignment struct {
+	UserName string `json:"username"`
+	AppID    string `json:"app_id"`
+	RoleID   string `json:"role_id"`
+}
+
+// AssignmentRow is an assignment read from line Row of an import file.
+type AssignmentRow struct {
+	Row int
+	Assignment
+}
+
+type AssignmentRowError struct {
+	Row     int    `json:"row"`
+	Message string `json:"message"`
+}
+
+// AssignmentImport reports an import. An import with any row errors
+// changes nothing.
+type AssignmentImport struct {
+	Mode    string                `json:"mode"`
+	AppID   string                `json:"app_id,omitempty"`
+	Rows    int                   `json:"rows"`
+	Added   []*Assignment         `json:"added"`
+	Removed []*Assignment         `json:"removed"`
+	Errors  []*AssignmentRowError `json:"errors"`
+}
+
+// AssignmentImportSummary is the audit record of a whole import. The
+// assignments themselves are recorded per user, as UserAssignmentChanges.
+type AssignmentImportSummary struct {
+	Mode    string `json:"mode"`
+	AppID   string `json:"app_id,omitempty"`
+	Rows    int    `json:"rows"`
+	Users   int    `json:"users"`
+	Added   int    `json:"added"`
+	Removed int    `json:"removed"`
+}
+
+// UserAssignmentChanges is the audit record of the assignments an import
+// granted and revoked for one user.
+type UserAssignmentChanges struct {
+	Mode    string        `json:"mode"`
+	Added   []*Assignment `json:"added"`
+	Removed []*Assignment `json:"removed"`
+}
@@ -0,0 +1,82 @@
+package model
+
+import "encoding/json"
+
+const (
+	EntityApplication = "application"
+	EntityPermission  = "permission"
+	EntityRole        = "role"
+	EntityUser        = "user"
+)
+
+const (
+	AuditActionCreate   = "create"
+	AuditActionUpdate   = "update"
+	AuditActionDelete   = "delete"
+	AuditActionRollback = "rollback"
+	AuditActionRestore  = "restore"
+	AuditActionPurge    = "purge"
+	AuditActionGrant    = "grant"
+	AuditActionRevoke   = "revoke"
+	AuditActionPromote  = "promote"
+	AuditActionImport   = "import"
+)
+
+type AuditLog struct {
+	ID        int64           `json:"id"`
+	Seq       int64           `json:"seq"`
+	Actor     string          `json:"actor"`
+	Action    string          `json:"action"`
+	Entity    string          `json:"entity"`
+	EntityID  string          `json:"entity_id"`
+	AppID     string          `json:"app_id"`
+	Before    json.RawMessage `json:"before"`
+	After     json.RawMessage `json:"after"`
+	Changes   json.RawMessage `json:"changes"`
+	CreatedAt Timestamp       `json:"created_at"`
+	PrevHash  string          `json:"prev_hash"`
+	Hash      string          `json:"hash"`
+}
+
+const (
+	AuditProblemGap             = "gap"
+	AuditProblemBrokenLink      = "broken_link"
+	AuditProblemHashMismatch    = "hash_mismatch"
+	AuditProblemUnchained       = "unchained"
+	AuditProblemChangesMismatch = "changes_mismatch"
+)
+
+type AuditProblem struct {
+	Seq    int64  `json:"seq"`
+	Kind   string `json:"kind"`
+	Detail string `json:"detail"`
+}
+
+// AuditVerification is the outcome of walking the audit hash chain. HeadHash
+// should be recorded out of band: it is what exposes truncation of the newest
+// entries.
+type AuditVerification struct {
+	Valid     bool            `json:"valid"`
+	Checked   int64           `json:"checked"`
+	Unchained int64           `json:"unchained"`
+	FirstSeq  int64           `json:"first_seq"`
+	LastSeq   int64           `json:"last_seq"`
+	HeadHash  string          `json:"head_hash"`
+	Problems  []*AuditProblem `json:"problems"`
+}
+
+type AuditArchive struct {
+	File     string `json:"file"`
+	FirstSeq int64  `json:"first_seq"`
+	LastSeq  int64  `json:"last_seq"`
+	Count    int64  `json:"count"`
+}
+
+// PurgeResult counts the soft-deleted rows permanently removed by a purge,
+// not including rows removed by cascade.
+type PurgeResult struct {
+	Applications int64 `json:"applications"`
+	Permissions  int64 `json:"permissions"`
+	Roles        int64 `json:"roles"`
+	Users        int64 `json:"users"`
+}
@@ -0,0 +1,29 @@
+package model
+
+// CasbinRule is a policy line mapped onto Guardian: a "p" line attaches
+// permission Object to role Subject, a "g" line assigns role Object to user
+// Subject. Domain is the application either way.
+type CasbinRule struct {
+	Line    int
+	PType   string
+	Subject string
+	Domain  string
+	Object  string
+}
+
+// UnmappedLine is a policy line with no Guardian equivalent.
+type UnmappedLine struct {
+	Line   int    `json:"line"`
+	Text   string `json:"text"`
+	Reason string `json:"reason"`
+}
+
+// CasbinImport reports a policy import. Created lists the permissions, roles
+// and users that lines referred to before they existed.
+type CasbinImport struct {
+	Lines    int             `json:"lines"`
+	Created  []*ChangeRef    `json:"created"`
+	Attached int             `json:"attached"`
+	Granted  int             `json:"granted"`
+	Unmapped []*UnmappedLine `json:"unmapped"`
+}
@@ -0,0 +1,16 @@
+package model
+
+type TableChanges struct {
+	Table    string `json:"table"`
+	Inserted int64  `json:"inserted"`
+	Updated  int64  `json:"updated"`
+	Deleted  int64  `json:"deleted"`
+}
+
+// ChangeSummary describes what a write did, or would have done in a dry run.
+// AffectedUsers lists users whose effective access changed.
+type ChangeSummary struct {
+	DryRun        bool            `json:"dry_run"`
+	Tables        []*TableChanges `json:"tables"`
+	AffectedUsers []string        `json:"affected_users"`
+}
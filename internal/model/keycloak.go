@@ -0,0 +1,35 @@
+package model
+
+// KeycloakMapping records what became of one object of a Keycloak realm
+// export. Target is empty for skipped objects, and Note explains a skip or
+// a lossy mapping such as a flattened composite role.
+type KeycloakMapping struct {
+	Kind   string `json:"kind"`
+	Source string `json:"source"`
+	Target string `json:"target,omitempty"`
+	Note   string `json:"note,omitempty"`
+}
+
+// KeycloakReport describes how a realm maps onto Guardian. Users and
+// Assignments count the users and user-role assignments imported.
+// Applications lists, per client, the entities the import creates or
+// overwrites, once it has run or been previewed.
+type KeycloakReport struct {
+	Realm        string             `json:"realm"`
+	Mapped       []*KeycloakMapping `json:"mapped"`
+	Skipped      []*KeycloakMapping `json:"skipped"`
+	Users        int                `json:"users"`
+	Assignments  int                `json:"assignments"`
+	Applied      bool               `json:"applied"`
+	Applications []*ManifestResult  `json:"applications,omitempty"`
+	Changes      *ChangeSummary     `json:"changes,omitempty"`
+}
+
+// KeycloakImport is a realm export mapped onto Guardian: one manifest per
+// client, plus users and their assignments.
+type KeycloakImport struct {
+	Manifests   []*Manifest
+	Users       []string
+	Assignments []*Assignment
+	Report      *KeycloakReport
+}
@@ -0,0 +1,80 @@
+package model
+
+// ManifestVersion is the manifest format written by exports. Imports reject
+// any other version.
+const ManifestVersion = 1
+
+// Manifest is the declarative definition of an application: the app, its
+// permissions and its roles, which name their permissions by ID.
+type Manifest struct {
+	Version     int                   `json:"version" yaml:"version"`
+	Application ManifestApplication   `json:"application" yaml:"application"`
+	Permissions []*ManifestPermission `json:"permissions" yaml:"permissions"`
+	Roles       []*ManifestRole       `json:"roles" yaml:"roles"`
+}
+
+type ManifestApplication struct {
+	ID          string `json:"id" yaml:"id"`
+	Name        string `json:"name" yaml:"name"`
+	Description string `json:"description" yaml:"description"`
+}
+
+type ManifestPermission struct {
+	ID          string `json:"id" yaml:"id"`
+	Name        string `json:"name" yaml:"name"`
+	Description string `json:"description" yaml:"description"`
+}
+
+type ManifestRole struct {
+	ID          string   `json:"id" yaml:"id"`
+	Name        string   `json:"name" yaml:"name"`
+	Description string   `json:"description" yaml:"description"`
+	Permissions []string `json:"permissions" yaml:"permissions"`
+}
+
+// Manifest change actions.
+const (
+	ManifestCreate = "create"
+	ManifestUpdate = "update"
+	ManifestDelete = "delete"
+)
+
+// ManifestChange is a change needed to bring an entity in line with a
+// manifest. Fields names what an update changes.
+type ManifestChange struct {
+	Entity string   `json:"entity"`
+	ID     string   `json:"id"`
+	Action string   `json:"action"`
+	Fields []string `json:"fields,omitempty"`
+}
+
+// ManifestResult reports an import. Entities the manifest already matched
+// are not listed.
+type ManifestResult struct {
+	AppID   string            `json:"app_id"`
+	Changes []*ManifestChange `json:"changes"`
+}
+
+// Plan lists the changes that reconciling an application with a manifest
+// makes, in the order they are applied. With Prune, permissions and roles
+// the manifest does not declare are deleted. Drift lists managed entities
+// edited outside of reconciliation since it last ran; applying the plan
+// overwrites those edits.
+type Plan struct {
+	AppID   string            `json:"app_id"`
+	Prune   bool              `json:"prune"`
+	Applied bool              `json:"applied"`
+	Changes []*ManifestChange `json:"changes"`
+	Drift   []*Drift          `json:"drift"`
+}
+
+// Drift is a managed entity that no longer is as reconciliation left it:
+// its version moved on from ManagedVersion, or it was deleted.
+type Drift struct {
+	Entity         string    `json:"entity"`
+	ID             string    `json:"id"`
+	ManagedVersion int       `json:"managed_version"`
+	CurrentVersion int       `json:"current_version"`
+	Deleted        bool      `json:"deleted"`
+	AppliedAt      Timestamp `json:"applied_at"`
+}
@@ -0,0 +1,9 @@
+package model
+
+// RoleMember is a user assigned to a role. AssignedAt is when the current,
+// uninterrupted assignment began. Roles are only ever assigned to users
+// directly; there are no groups.
+type RoleMember struct {
+	UserName   string    `json:"username"`
+	AssignedAt Timestamp `json:"assigned_at"`
+}
@@ -0,0 +1,29 @@
+package model
+
+// OPAData is Guardian's state as Rego sees it, keyed for direct lookups:
+// Permissions and Roles by app and then ID, UserRoles by user and then app.
+// OPAData is the data document of an OPA bundle. Revision identifies the
+// state it was read at and is not part of the document.
+type OPAData struct {
+	Revision    string                               `json:"-"`
+	Apps        map[string]*OPAApp                   `json:"apps"`
+	Permissions map[string]map[string]*OPAPermission `json:"permissions"`
+	Roles       map[string]map[string]*OPARole       `json:"roles"`
+	UserRoles   map[string]map[string][]string       `json:"user_roles"`
+}
+
+type OPAApp struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type OPAPermission struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type OPARole struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
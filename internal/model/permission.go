@@ -1,9 +1,11 @@
 package model
 
 type Application struct {
-	ID          string `json:"id"`
-	Name        string `json:"name"`
-	Description string `json:"description"`
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	CreatedAt   Timestamp `json:"created_at"`
+	Version     int       `json:"version,omitempty"`
 }
 
 type Permission struct {
@@ -12,6 +14,7 @@ type Permission struct {
 	Name        string    `json:"name"`
 	Description string    `json:"description"`
 	CreatedAt   Timestamp `json:"created_at"`
+	Version     int       `json:"version,omitempty"`
 }
 
 type Role struct {
@@ -21,4 +24,5 @@ type Role struct {
 	Description string        `json:"description"`
 	Permissions []*Permission `json:"permissions"`
 	CreatedAt   Timestamp     `json:"created_at"`
+	Version     int           `json:"version,omitempty"`
 }
@@ -0,0 +1,54 @@
+package model
+
+// Bundle carries an application's definition out of one Guardian instance
+// so that it can be promoted into another. Digest is the hex SHA-256 of the
+// manifest's JSON encoding. Signature is an HMAC over the digest and the
+// bundle's origin, keyed with a secret the instances share, which lets the
+// target reject a bundle that anyone without the key altered or forged.
+type Bundle struct {
+	Environment string    `json:"environment"`
+	ExportedAt  Timestamp `json:"exported_at"`
+	Digest      string    `json:"digest"`
+	Signature   string    `json:"signature"`
+	Manifest    *Manifest `json:"manifest"`
+}
+
+// ChangeRef names one change of a promotion diff.
+type ChangeRef struct {
+	Entity string `json:"entity"`
+	ID     string `json:"id"`
+}
+
+// PromotionChange is a difference between the bundle and the target, with
+// the entity as each side defines it; Source is empty for deletions and
+// Target for creations.
+type PromotionChange struct {
+	*ManifestChange
+	Source interface{} `json:"source,omitempty"`
+	Target interface{} `json:"target,omitempty"`
+}
+
+// PromotionDiff lists every change promoting a bundle could make to the
+// target application, deletions of what the bundle lacks included.
+type PromotionDiff struct {
+	AppID   string             `json:"app_id"`
+	Source  string             `json:"source"`
+	Target  string             `json:"target"`
+	Changes []*PromotionChange `json:"changes"`
+}
+
+// Promotion asks for the selected changes of a bundle's diff to be applied.
+type Promotion struct {
+	Bundle *Bundle      `json:"bundle"`
+	Select []*ChangeRef `json:"select"`
+}
+
+// PromotionResult reports the changes a promotion applied. It is also the
+// body of the promotion's audit entry.
+type PromotionResult struct {
+	AppID   string            `json:"app_id"`
+	Source  string            `json:"source"`
+	Target  string            `json:"target"`
+	Digest  string            `json:"digest"`
+	Applied []*ManifestChange `json:"applied"`
+}
@@ -0,0 +1,44 @@
+package model
+
+// RoleVersion is an immutable snapshot of a role taken after every change to
+// its name, description or permission set.
+type RoleVersion struct {
+	RoleID        string    `json:"role_id"`
+	AppID         string    `json:"app_id"`
+	Version       int       `json:"version"`
+	Name          string    `json:"name"`
+	Description   string    `json:"description"`
+	PermissionIDs []string  `json:"permission_ids"`
+	Actor         string    `json:"actor"`
+	CreatedAt     Timestamp `json:"created_at"`
+}
+
+type FieldChange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type RoleVersionDiff struct {
+	RoleID             string       `json:"role_id"`
+	AppID              string       `json:"app_id"`
+	From               int          `json:"from"`
+	To                 int          `json:"to"`
+	Name               *FieldChange `json:"name,omitempty"`
+	Description        *FieldChange `json:"description,omitempty"`
+	AddedPermissions   []string     `json:"added_permissions"`
+	RemovedPermissions []string     `json:"removed_permissions"`
+}
+
+// RolePermissionDelta asks for permissions to be attached to and detached
+// from a role without restating the whole set.
+type RolePermissionDelta struct {
+	Add    []string `json:"add"`
+	Remove []string `json:"remove"`
+}
+
+// RolePermissionChanges reports the part of a RolePermissionDelta that took
+// effect; permissions already attached or already absent are left out.
+type RolePermissionChanges struct {
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+}
@@ -0,0 +1,23 @@
+package model
+
+// SearchHit is an entity matching a search. Entities found only through a
+// related match, such as a role containing a matching permission, name that
+// entity in Via and rank below direct matches.
+type SearchHit struct {
+	Entity      string  `json:"entity"`
+	ID          string  `json:"id"`
+	AppID       string  `json:"app_id,omitempty"`
+	Name        string  `json:"name,omitempty"`
+	Description string  `json:"description,omitempty"`
+	Rank        float64 `json:"rank"`
+	Via         string  `json:"via,omitempty"`
+}
+
+// SearchResults groups hits by entity type, each group ordered by rank.
+type SearchResults struct {
+	Query        string       `json:"query"`
+	Applications []*SearchHit `json:"applications"`
+	Permissions  []*SearchHit `json:"permissions"`
+	Roles        []*SearchHit `json:"roles"`
+	Users        []*SearchHit `json:"users"`
+}
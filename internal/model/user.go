@@ -5,4 +5,5 @@ type User struct {
 	Roles     []*Role   `json:"roles"`
 	CreatedAt Timestamp `json:"created_at"`
 	UpdatedAt Timestamp `json:"updated_at"`
+	Version   int       `json:"version,omitempty"`
 }
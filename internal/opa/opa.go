@@ -0,0 +1,103 @@
+// Package opa packages Guardian's data as an Open Policy Agent bundle, a
+// tar.gz that OPA polls and loads under data.guardian.
+package opa
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"guardian/internal/model"
+	"io"
+	"time"
+)
+
+// Root is the bundle's only root, and so the data path it owns.
+const Root = "guardian"
+
+// Rego is the optional policy library shipped with the bundle. Input names
+// the user, the app and the permission to check.
+const Rego = `package guardian.authz
+
+import future.keywords.contains
+import future.keywords.if
+import future.keywords.in
+
+default allow := false
+
+# allow holds when one of the user's roles in input.app grants
+# input.permission.
+allow if {
+	input.permission in permissions
+}
+
+# permissions is the set of permissions the user holds in input.app.
+permissions contains perm if {
+	some role in data.guardian.user_roles[input.user][input.app]
+	some perm in data.guardian.roles[input.app][role].permissions
+}
+`
+
+// Bundle is a built bundle. Revision is the hex SHA-256 of its data, so it
+// changes exactly when the data does.
+type Bundle struct {
+	Revision string
+	Rego     bool
+	data     []byte
+}
+
+// New encodes data for a bundle, with the Rego library if rego is set.
+func New(data *model.OPAData, rego bool) (*Bundle, error) {
+	doc, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(doc)
+	return &Bundle{Revision: hex.EncodeToString(sum[:]), Rego: rego, data: doc}, nil
+}
+
+// Write writes the bundle as a tar.gz. Timestamps are fixed so that equal
+// bundles are byte for byte equal.
+func (b *Bundle) Write(w io.Writer) error {
+	manifest, err := json.Marshal(map[string]interface{}{
+		"revision": b.Revision,
+		"roots":    []string{Root},
+	})
+	if err != nil {
+		return err
+	}
+	type file struct {
+		name string
+		body []byte
+	}
+	files := []file{
+		{"/.manifest", manifest},
+		{"/" + Root + "/data.json", b.data},
+	}
+	if b.Rego {
+		files = append(files, file{"/" + Root + "/authz.rego", []byte(Rego)})
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	for _, file := range files {
+		hdr := &tar.Header{
+			Name:     file.name,
+			Mode:     0o644,
+			Size:     int64(len(file.body)),
+			ModTime:  time.Unix(0, 0),
+			Typeflag: tar.TypeReg,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(file.body); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"guardian/internal/database"
+	"guardian/internal/model"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// asOfParam reads the optional as_of query parameter used by point-in-time
+// reads. A nil result means "now".
+func asOfParam(c echo.Context) (*time.Time, error) {
+	v := c.QueryParam("as_of")
+	if v == "" {
+		return nil, nil
+	}
+	t, err := parseTime(v)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid as_of: %s", v))
+	}
+	return &t, nil
+}
+
+func (s *Server) GetEffectivePermissionsHandler(c echo.Context) error {
+	userName := c.Param("userName")
+	appID := c.QueryParam("app_id")
+	asOf, err := asOfParam(c)
+	if err != nil {
+		return err
+	}
+	perms, err := s.db.GetEffectivePermissions(c.Request().Context(), userName, appID, asOf)
+	if err != nil {
+		return httpError(err)
+	}
+
+	return c.JSON(http.StatusOK, perms)
+}
+
+// CheckPermissionHandler answers whether the user held permission_id in
+// app_id, now or as of as_of, and through which roles.
+func (s *Server) CheckPermissionHandler(c echo.Context) error {
+	decision := &model.Decision{
+		UserName:     c.Param("userName"),
+		AppID:        c.QueryParam("app_id"),
+		PermissionID: c.QueryParam("permission_id"),
+		Roles:        make([]string, 0),
+	}
+	if decision.AppID == "" || decision.PermissionID == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "app_id and permission_id are required")
+	}
+	asOf, err := asOfParam(c)
+	if err != nil {
+		return err
+	}
+	// An unknown user is simply denied.
+	perms, err := s.db.GetEffectivePermissions(c.Request().Context(), decision.UserName, decision.AppID, asOf)
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		return httpError(err)
+	}
+	for _, perm := range perms {
+		if perm.PermissionID == decision.PermissionID {
+			decision.Allowed = true
+			decision.Roles = perm.Roles
+		}
+	}
+
+	return c.JSON(http.StatusOK, decision)
+}
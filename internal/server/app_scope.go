@@ -0,0 +1,113 @@
+package server
+
+import (
+	"guardian/internal/database"
+	"guardian/internal/filter"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Permissions and roles are reachable both at the top level, keyed as
+// /permissions/:permID/:appID, and nested as /apps/:appID/permissions/:permID.
+
+// nested reports whether the request was routed through /apps/:appID.
+func nested(c echo.Context) bool {
+	return strings.HasPrefix(c.Path(), "/apps/:appID/")
+}
+
+func permPath(c echo.Context, permID string, appID string) string {
+	if nested(c) {
+		return "/apps/" + url.PathEscape(appID) + "/permissions/" + url.PathEscape(permID)
+	}
+	return "/permissions/" + url.PathEscape(permID) + "/" + url.PathEscape(appID)
+}
+
+func rolePath(c echo.Context, roleID string, appID string) string {
+	if nested(c) {
+		return "/apps/" + url.PathEscape(appID) + "/roles/" + url.PathEscape(roleID)
+	}
+	return "/roles/" + url.PathEscape(roleID) + "/" + url.PathEscape(appID)
+}
+
+// appScopedOptions reads the list parameters of a nested list and restricts
+// it to the application in the path, which must exist.
+func (s *Server) appScopedOptions(c echo.Context, nameField string, scope ...filter.Expr) (*database.ListOptions, error) {
+	appID := c.Param("appID")
+	if _, err := s.db.GetApp(c.Request().Context(), appID); err != nil {
+		return nil, httpError(err)
+	}
+	opts, err := listOptions(c, "app_id", nameField)
+	if err != nil {
+		return nil, err
+	}
+	scope = append(scope, filter.Compare{Field: "app_id", Op: filter.Eq, Value: appID})
+	opts.Filter = filter.All(append([]filter.Expr{opts.Filter}, scope...)...)
+	return opts, nil
+}
+
+func (s *Server) GetAppPermsHandler(c echo.Context) error {
+	opts, err := s.appScopedOptions(c, "name")
+	if err != nil {
+		return err
+	}
+	perms, next, err := s.db.GetPerms(c.Request().Context(), opts)
+	if err != nil {
+		return httpError(err)
+	}
+
+	return c.JSON(http.StatusOK, &listPage{Data: perms, NextCursor: next})
+}
+
+func (s *Server) GetAppRolesHandler(c echo.Context) error {
+	opts, err := s.appScopedOptions(c, "name")
+	if err != nil {
+		return err
+	}
+	roles, next, err := s.db.GetRoles(c.Request().Context(), opts)
+	if err != nil {
+		return httpError(err)
+	}
+
+	return c.JSON(http.StatusOK, &listPage{Data: roles, NextCursor: next})
+}
+
+// GetAppUsersHandler lists the users holding at least one role in the
+// application.
+func (s *Server) GetAppUsersHandler(c echo.Context) error {
+	opts, err := s.appScopedOptions(c, "username")
+	if err != nil {
+		return err
+	}
+	view := userView(c)
+	users, next, err := s.db.GetUsers(c.Request().Context(), opts, view)
+	if err != nil {
+		return httpError(err)
+	}
+	data, err := sparse(users, view.Paths())
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, &listPage{Data: data, NextCursor: next})
+}
+
+// GetRolePermsHandler lists the permissions attached to a role.
+func (s *Server) GetRolePermsHandler(c echo.Context) error {
+	roleID := c.Param("roleID")
+	if _, err := s.db.GetRole(c.Request().Context(), roleID, c.Param("appID")); err != nil {
+		return httpError(err)
+	}
+	opts, err := s.appScopedOptions(c, "name", filter.Compare{Field: "role_id", Op: filter.Eq, Value: roleID})
+	if err != nil {
+		return err
+	}
+	perms, next, err := s.db.GetPerms(c.Request().Context(), opts)
+	if err != nil {
+		return httpError(err)
+	}
+
+	return c.JSON(http.StatusOK, &listPage{Data: perms, NextCursor: next})
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"guardian/internal/database"
+	"guardian/internal/model"
+	"io"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+var assignmentHeader = []string{"username", "app_id", "role_id"}
+
+// ExportAssignmentsHandler streams user-role assignments as CSV, optionally
+// only those of ?app_id=.
+func (s *Server) ExportAssignmentsHandler(c echo.Context) error {
+	resp := c.Response()
+	resp.Header().Set(echo.HeaderContentType, "text/csv")
+	resp.Header().Set("Content-Disposition", `attachment; filename="assignments.csv"`)
+	resp.WriteHeader(http.StatusOK)
+
+	w := csv.NewWriter(resp)
+	if err := w.Write(assignmentHeader); err != nil {
+		return err
+	}
+	err := s.db.ExportAssignments(c.Request().Context(), c.QueryParam("app_id"), func(a *model.Assignment) error {
+		return w.Write([]string{a.UserName, a.AppID, a.RoleID})
+	})
+	w.Flush()
+	if err != nil {
+		return err
+	}
+	return w.Error()
+}
+
+// ImportAssignmentsHandler applies a CSV of assignments in the ?mode= add
+// (default), replace or sync, optionally confined to ?app_id=. The header
+// row names the username, app_id and role_id columns in any order. An
+// import with row errors changes nothing and answers 422 with the rows.
+func (s *Server) ImportAssignmentsHandler(c echo.Context) error {
+	mode := c.QueryParam("mode")
+	if mode == "" {
+		mode = model.ImportAdd
+	}
+	appID := c.QueryParam("app_id")
+
+	if isDryRun(c) {
+		return s.dryRun(c, func(ctx context.Context) error {
+			next, err := assignmentReader(c.Request().Body)
+			if err != nil {
+				return err
+			}
+			result, err := s.db.ImportAssignments(ctx, mode, appID, next)
+			if err == nil && len(result.Errors) > 0 {
+				err = &database.Error{Kind: database.ErrValidation, Code: "invalid_rows", Message: fmt.Sprintf("%d rows are invalid", len(result.Errors))}
+			}
+			return err
+		})
+	}
+
+	next, err := assignmentReader(c.Request().Body)
+	if err != nil {
+		return err
+	}
+	result, err := s.db.ImportAssignments(c.Request().Context(), mode, appID, next)
+	if err != nil {
+		return httpError(err)
+	}
+	if len(result.Errors) > 0 {
+		return c.JSON(http.StatusUnprocessableEntity, result)
+	}
+
+	return c.JSON(http.StatusOK, result)
+}
+
+// assignmentReader reads the CSV header from body and returns a function
+// yielding the rows after it, numbered by line, until io.EOF.
+func assignmentReader(body io.Reader) (func() (*model.AssignmentRow, error), error) {
+	r := csv.NewReader(body)
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	header, err := r.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "CSV is empty")
+	}
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "invalid CSV: "+err.Error())
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[name] = i
+	}
+	for _, name := range assignmentHeader {
+		if _, ok := columns[name]; !ok {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, "CSV header lacks "+name)
+		}
+	}
+
+	return func() (*model.AssignmentRow, error) {
+		record, err := r.Read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, err
+			}
+			return nil, echo.NewHTTPError(http.StatusBadRequest, "invalid CSV: "+err.Error())
+		}
+		line, _ := r.FieldPos(0)
+		field := func(name string) string {
+			if i := columns[name]; i < len(record) {
+				return record[i]
+			}
+			return ""
+		}
+		return &model.AssignmentRow{
+			Row: line,
+			Assignment: model.Assignment{
+				UserName: field("username"),
+				AppID:    field("app_id"),
+				RoleID:   field("role_id"),
+			},
+		}, nil
+	}, nil
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"crypto/sha256"
+	"guardian/internal/database"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// tokens maps the SHA-256 digest of each API token to the identity it
+// authenticates. Looking up the digest rather than the token keeps the
+// comparison time independent of how much of a guess is right.
+type tokens map[[sha256.Size]byte]string
+
+// parseTokens reads GUARDIAN_API_TOKENS, a comma-separated list of
+// actor=token pairs. Pairs without both parts are ignored.
+func parseTokens(v string) tokens {
+	t := make(tokens)
+	for _, pair := range strings.Split(v, ",") {
+		actor, token, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || actor == "" || token == "" {
+			continue
+		}
+		t[sha256.Sum256([]byte(token))] = actor
+	}
+	return t
+}
+
+// authMiddleware attributes the request to the identity of its bearer token,
+// which database writes record as the audit actor. Reads may be anonymous,
+// but every other request must authenticate, and a token that is presented
+// must be valid.
+func (s *Server) authMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		header := req.Header.Get(echo.HeaderAuthorization)
+		if header == "" {
+			if req.Method == http.MethodGet || req.Method == http.MethodHead {
+				return next(c)
+			}
+			return unauthorized(c, "authentication is required for changes")
+		}
+
+		if !strings.HasPrefix(header, "Bearer ") {
+			return unauthorized(c, "Authorization must be a bearer token")
+		}
+		token := strings.TrimPrefix(header, "Bearer ")
+		actor, ok := s.tokens[sha256.Sum256([]byte(token))]
+		if !ok {
+			return unauthorized(c, "invalid bearer token")
+		}
+		c.SetRequest(req.WithContext(database.WithActor(req.Context(), actor)))
+		return next(c)
+	}
+}
+
+func unauthorized(c echo.Context, detail string) error {
+	c.Response().Header().Set(echo.HeaderWWWAuthenticate, "Bearer")
+	return echo.NewHTTPError(http.StatusUnauthorized, detail)
+}
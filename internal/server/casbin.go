@@ -0,0 +1,79 @@
+package server
+
+import (
+	"context"
+	"guardian/internal/casbin"
+	"guardian/internal/database"
+	"guardian/internal/filter"
+	"guardian/internal/model"
+	"net/http"
+	"sort"
+
+	"github.com/labstack/echo/v4"
+)
+
+func (s *Server) CasbinModelHandler(c echo.Context) error {
+	return c.String(http.StatusOK, casbin.Model)
+}
+
+// ExportCasbinPolicyHandler streams role permissions as p lines and user
+// assignments as g lines, optionally only those of ?app_id=.
+func (s *Server) ExportCasbinPolicyHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	appID := c.QueryParam("app_id")
+	opts := &database.ListOptions{}
+	if appID != "" {
+		opts.Filter = filter.Compare{Field: "app_id", Op: filter.Eq, Value: appID}
+	}
+	roles, _, err := s.db.GetRoles(ctx, opts)
+	if err != nil {
+		return httpError(err)
+	}
+
+	resp := c.Response()
+	resp.Header().Set(echo.HeaderContentType, "text/csv")
+	resp.Header().Set("Content-Disposition", `attachment; filename="policy.csv"`)
+	resp.WriteHeader(http.StatusOK)
+	w := casbin.NewWriter(resp)
+	for _, role := range roles {
+		for _, perm := range role.Permissions {
+			if err := w.Policy(role.ID, role.AppID, perm.ID); err != nil {
+				return err
+			}
+		}
+	}
+	err = s.db.ExportAssignments(ctx, appID, func(a *model.Assignment) error {
+		return w.Grouping(a.UserName, a.RoleID, a.AppID)
+	})
+	if flushErr := w.Flush(); err == nil {
+		err = flushErr
+	}
+	return err
+}
+
+// ImportCasbinPolicyHandler adds the policy in the body and reports the
+// lines it could not map.
+func (s *Server) ImportCasbinPolicyHandler(c echo.Context) error {
+	rules, unmapped, err := casbin.Parse(c.Request().Body)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid policy: "+err.Error())
+	}
+
+	if isDryRun(c) {
+		return s.dryRun(c, func(ctx context.Context) error {
+			_, err := s.db.ImportCasbin(ctx, rules)
+			return err
+		})
+	}
+
+	result, err := s.db.ImportCasbin(c.Request().Context(), rules)
+	if err != nil {
+		return httpError(err)
+	}
+	result.Unmapped = append(result.Unmapped, unmapped...)
+	sort.SliceStable(result.Unmapped, func(i, j int) bool {
+		return result.Unmapped[i].Line < result.Unmapped[j].Line
+	})
+
+	return c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,27 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// isDryRun reports whether a write request asked, via ?dry_run=true, to see
+// its effect without applying it.
+func isDryRun(c echo.Context) bool {
+	dryRun, _ := strconv.ParseBool(c.QueryParam("dry_run"))
+	return dryRun
+}
+
+// dryRun executes fn in a rolled-back transaction and responds with the
+// resulting change summary.
+func (s *Server) dryRun(c echo.Context, fn func(ctx context.Context) error) error {
+	summary, err := s.db.DryRun(c.Request().Context(), fn)
+	if err != nil {
+		return httpError(err)
+	}
+
+	return c.JSON(http.StatusOK, summary)
+}
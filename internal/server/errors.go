@@ -0,0 +1,127 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"guardian/internal/database"
+	"guardian/internal/validation"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Problem is an RFC 7807 problem details object. Code is a stable,
+// machine-readable identifier of the failure; Title and Detail are for
+// humans and may change. Errors lists invalid fields, if any.
+type Problem struct {
+	Type   string            `json:"type"`
+	Title  string            `json:"title"`
+	Status int               `json:"status"`
+	Detail string            `json:"detail,omitempty"`
+	Code   string            `json:"code"`
+	Errors validation.Errors `json:"errors,omitempty"`
+
+	err error
+}
+
+func (p *Problem) Error() string {
+	return p.Detail
+}
+
+func (p *Problem) Unwrap() error {
+	return p.err
+}
+
+func newProblem(status int, code string, detail string) *Problem {
+	return &Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// internalProblem hides err from the client; it is only logged.
+func internalProblem(err error) *Problem {
+	p := newProblem(http.StatusInternalServerError, "internal_error", "")
+	p.err = err
+	return p
+}
+
+// httpError maps a database error to the problem returned to the client.
+// Errors the database layer did not classify are reported as internal
+// without their message, which may contain SQL.
+func httpError(err error) error {
+	var dbErr *database.Error
+	var httpErr *echo.HTTPError
+	switch {
+	case errors.As(err, &httpErr):
+		// Raised by the handler itself, such as from a reader the
+		// database layer was consuming.
+		return httpErr
+	case errors.Is(err, database.ErrPreconditionFailed):
+		return newProblem(http.StatusPreconditionFailed, "precondition_failed", err.Error())
+	case errors.As(err, &dbErr):
+		p := newProblem(kindStatus(dbErr.Kind), dbErr.Code, dbErr.Message)
+		p.Errors = dbErr.Fields
+		return p
+	}
+	return internalProblem(err)
+}
+
+func kindStatus(kind error) int {
+	switch kind {
+	case database.ErrNotFound:
+		return http.StatusNotFound
+	case database.ErrConflict:
+		return http.StatusConflict
+	case database.ErrInvalidReference, database.ErrValidation:
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusInternalServerError
+}
+
+// statusCode derives a problem code from an HTTP status, for errors raised
+// by echo or by handlers without a more specific code.
+func statusCode(status int) string {
+	return strings.ToLower(strings.ReplaceAll(http.StatusText(status), " ", "_"))
+}
+
+// problemHandler renders every error returned by a handler as
+// application/problem+json.
+func problemHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	var p *Problem
+	var he *echo.HTTPError
+	switch {
+	case errors.As(err, &p):
+	case errors.As(err, &he):
+		p = newProblem(he.Code, statusCode(he.Code), fmt.Sprint(he.Message))
+		if he.Internal != nil {
+			p.err = he.Internal
+		}
+		if he.Code >= http.StatusInternalServerError {
+			p.Detail = ""
+		}
+	default:
+		p = internalProblem(err)
+	}
+	if p.Status >= http.StatusInternalServerError {
+		c.Logger().Error(err)
+	}
+
+	c.Response().Header().Set(echo.HeaderContentType, "application/problem+json")
+	if c.Request().Method == http.MethodHead {
+		err = c.NoContent(p.Status)
+	} else {
+		err = c.JSON(p.Status, p)
+	}
+	if err != nil {
+		c.Logger().Error(err)
+	}
+}
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"fmt"
+	"guardian/internal/database"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+func etag(version int) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+func setETag(c echo.Context, version int) {
+	c.Response().Header().Set("ETag", etag(version))
+}
+
+// ifMatchMiddleware turns an If-Match header on a write into an expected
+// version for the database layer. "*" only asks for the entity to exist,
+// which the write checks anyway, so it is not forwarded.
+func ifMatchMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		match := req.Header.Get("If-Match")
+		if match == "" || match == "*" || req.Method == http.MethodGet || req.Method == http.MethodHead {
+			return next(c)
+		}
+
+		version, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(match, "W/"), `"`))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusPreconditionFailed, "If-Match does not name a version of this resource")
+		}
+		c.SetRequest(req.WithContext(database.WithExpectedVersion(req.Context(), version)))
+		return next(c)
+	}
+}
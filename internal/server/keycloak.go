@@ -0,0 +1,54 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"guardian/internal/keycloak"
+	"guardian/internal/model"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// bindRealm maps the realm export in the request body.
+func bindRealm(c echo.Context) (*model.KeycloakImport, error) {
+	realm := new(keycloak.Realm)
+	if err := json.NewDecoder(c.Request().Body).Decode(realm); err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "invalid realm export: "+err.Error())
+	}
+	return keycloak.Map(realm), nil
+}
+
+// PreviewKeycloakHandler reports how a realm export maps onto Guardian and
+// the changes importing it would make, without applying them.
+func (s *Server) PreviewKeycloakHandler(c echo.Context) error {
+	imp, err := bindRealm(c)
+	if err != nil {
+		return err
+	}
+
+	summary, err := s.db.DryRun(c.Request().Context(), func(ctx context.Context) error {
+		return s.db.ImportKeycloak(ctx, imp)
+	})
+	if err != nil {
+		return httpError(err)
+	}
+	imp.Report.Changes = summary
+
+	return c.JSON(http.StatusOK, imp.Report)
+}
+
+// ImportKeycloakHandler applies a realm export and reports its mapping.
+func (s *Server) ImportKeycloakHandler(c echo.Context) error {
+	imp, err := bindRealm(c)
+	if err != nil {
+		return err
+	}
+
+	if err := s.db.ImportKeycloak(c.Request().Context(), imp); err != nil {
+		return httpError(err)
+	}
+	imp.Report.Applied = true
+
+	return c.JSON(http.StatusOK, imp.Report)
+}
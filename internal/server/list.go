@@ -0,0 +1,101 @@
+package server
+
+import (
+	"fmt"
+	"guardian/internal/database"
+	"guardian/internal/filter"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// listPage is the body of every paginated list. NextCursor is passed back
+// as ?cursor= to fetch the following page and is omitted on the last one.
+type listPage struct {
+	Data       interface{} `json:"data"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
+
+// listOptions collects the paging, sorting and filtering parameters shared
+// by the list endpoints. A SCIM expression in ?filter= is combined with the
+// shorthand parameters app_id, name_prefix, created_from and created_to,
+// which filter on appField, nameField and created_at.
+func listOptions(c echo.Context, appField string, nameField string) (*database.ListOptions, error) {
+	opts, err := pageOptions(c)
+	if err != nil {
+		return nil, err
+	}
+
+	expr, err := filterParam(c)
+	if err != nil {
+		return nil, err
+	}
+	exprs := []filter.Expr{expr}
+	if v := c.QueryParam("app_id"); v != "" {
+		exprs = append(exprs, filter.Compare{Field: appField, Op: filter.Eq, Value: v})
+	}
+	if v := c.QueryParam("name_prefix"); v != "" {
+		exprs = append(exprs, filter.Compare{Field: nameField, Op: filter.Sw, Value: v})
+	}
+	created, err := timeRange(c, "created_at", "created_from", "created_to")
+	if err != nil {
+		return nil, err
+	}
+	opts.Filter = filter.All(append(exprs, created...)...)
+	return opts, nil
+}
+
+// pageOptions collects the paging and sorting parameters of a list.
+func pageOptions(c echo.Context) (*database.ListOptions, error) {
+	opts := &database.ListOptions{
+		Sort:   c.QueryParam("sort"),
+		Cursor: c.QueryParam("cursor"),
+		Limit:  defaultPageSize,
+	}
+	if v := c.QueryParam("limit"); v != "" {
+		var err error
+		if opts.Limit, err = strconv.Atoi(v); err != nil || opts.Limit <= 0 || opts.Limit > maxPageSize {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxPageSize))
+		}
+	}
+	return opts, nil
+}
+
+// filterParam parses the SCIM filter expression in ?filter=, if any.
+func filterParam(c echo.Context) (filter.Expr, error) {
+	v := c.QueryParam("filter")
+	if v == "" {
+		return nil, nil
+	}
+	expr, err := filter.Parse(v)
+	if err != nil {
+		return nil, newProblem(http.StatusBadRequest, "invalid_filter", err.Error())
+	}
+	return expr, nil
+}
+
+// timeRange turns the from and to query parameters into filters selecting
+// field within [from, to).
+func timeRange(c echo.Context, field string, from string, to string) ([]filter.Expr, error) {
+	var exprs []filter.Expr
+	for _, bound := range []struct {
+		param string
+		op    filter.Op
+	}{{from, filter.Ge}, {to, filter.Lt}} {
+		v := c.QueryParam(bound.param)
+		if v == "" {
+			continue
+		}
+		if _, err := parseTime(v); err != nil {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid %s: %s", bound.param, v))
+		}
+		exprs = append(exprs, filter.Compare{Field: field, Op: bound.op, Value: v})
+	}
+	return exprs, nil
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"guardian/internal/model"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"gopkg.in/yaml.v3"
+)
+
+const mimeYAML = "application/yaml"
+
+// ExportManifestHandler returns an application's manifest as JSON, or as
+// YAML when asked for with ?format=yaml or an Accept header naming YAML.
+func (s *Server) ExportManifestHandler(c echo.Context) error {
+	manifest, err := s.db.ExportManifest(c.Request().Context(), c.Param("appID"))
+	if err != nil {
+		return httpError(err)
+	}
+
+	format := c.QueryParam("format")
+	if format == "" && strings.Contains(c.Request().Header.Get(echo.HeaderAccept), "yaml") {
+		format = "yaml"
+	}
+	switch format {
+	case "", "json":
+		return c.JSON(http.StatusOK, manifest)
+	case "yaml":
+		data, err := yaml.Marshal(manifest)
+		if err != nil {
+			return err
+		}
+		return c.Blob(http.StatusOK, mimeYAML, data)
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unsupported format: %s", format))
+	}
+}
+
+// ImportManifestHandler applies the manifest in the body, JSON or YAML by
+// Content-Type, to the application in the URL.
+func (s *Server) ImportManifestHandler(c echo.Context) error {
+	manifest, err := bindManifest(c)
+	if err != nil {
+		return err
+	}
+	if err := bindKey(&manifest.Application.ID, "application.id", c.Param("appID")); err != nil {
+		return err
+	}
+
+	if isDryRun(c) {
+		return s.dryRun(c, func(ctx context.Context) error {
+			_, err := s.db.ImportManifest(ctx, manifest)
+			return err
+		})
+	}
+
+	result, err := s.db.ImportManifest(c.Request().Context(), manifest)
+	if err != nil {
+		return httpError(err)
+	}
+
+	return c.JSON(http.StatusOK, result)
+}
+
+// bindManifest decodes the manifest in the request body, rejecting unknown
+// keys so that typos do not pass for omitted fields.
+func bindManifest(c echo.Context) (*model.Manifest, error) {
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return nil, err
+	}
+	manifest := new(model.Manifest)
+	if strings.Contains(c.Request().Header.Get(echo.HeaderContentType), "yaml") {
+		dec := yaml.NewDecoder(bytes.NewReader(body))
+		dec.KnownFields(true)
+		err = dec.Decode(manifest)
+	} else {
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(manifest)
+	}
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "invalid manifest: "+err.Error())
+	}
+	return manifest, nil
+}
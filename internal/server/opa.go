@@ -0,0 +1,65 @@
+package server
+
+import (
+	"bytes"
+	"guardian/internal/opa"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// OPABundleHandler serves an OPA bundle of Guardian's data, with the Rego
+// library when ?rego=true. The ETag follows the data revision, which is
+// checked against If-None-Match before any data is read, so OPA's polling
+// gets a cheap 304 until something changes.
+func (s *Server) OPABundleHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	rego, _ := strconv.ParseBool(c.QueryParam("rego"))
+
+	revision, err := s.db.OPARevision(ctx)
+	if err != nil {
+		return httpError(err)
+	}
+	if noneMatch(c.Request().Header.Get("If-None-Match"), bundleTag(revision, rego)) {
+		c.Response().Header().Set("ETag", bundleTag(revision, rego))
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	data, err := s.db.OPAData(ctx)
+	if err != nil {
+		return httpError(err)
+	}
+	bundle, err := opa.New(data, rego)
+	if err != nil {
+		return err
+	}
+	// The data may be newer than the revision checked above.
+	c.Response().Header().Set("ETag", bundleTag(data.Revision, rego))
+
+	var buf bytes.Buffer
+	if err := bundle.Write(&buf); err != nil {
+		return err
+	}
+	return c.Blob(http.StatusOK, "application/gzip", buf.Bytes())
+}
+
+func bundleTag(revision string, rego bool) string {
+	if rego {
+		revision += "-rego"
+	}
+	return `"` + revision + `"`
+}
+
+// noneMatch reports whether an If-None-Match header matches tag, comparing
+// weakly as RFC 9110 asks for GET.
+func noneMatch(header string, tag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == tag {
+			return true
+		}
+	}
+	return false
+}
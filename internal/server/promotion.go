@@ -0,0 +1,74 @@
+package server
+
+import (
+	"context"
+	"guardian/internal/model"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ExportBundleHandler packages the application for promotion into another
+// instance.
+func (s *Server) ExportBundleHandler(c echo.Context) error {
+	bundle, err := s.db.ExportBundle(c.Request().Context(), c.Param("appID"))
+	if err != nil {
+		return httpError(err)
+	}
+
+	return c.JSON(http.StatusOK, bundle)
+}
+
+// checkBundleKey rejects a bundle for another application than the URL's.
+// Unlike bindKey it cannot fill in a missing ID, which would break the
+// bundle's digest.
+func checkBundleKey(c echo.Context, bundle *model.Bundle) error {
+	if bundle != nil && bundle.Manifest != nil && bundle.Manifest.Application.ID != c.Param("appID") {
+		return echo.NewHTTPError(http.StatusBadRequest, "application.id in bundle does not match the URL")
+	}
+	return nil
+}
+
+// DiffBundleHandler compares the bundle in the body, exported from another
+// instance, with the application here.
+func (s *Server) DiffBundleHandler(c echo.Context) error {
+	bundle := new(model.Bundle)
+	if err := c.Bind(bundle); err != nil {
+		return err
+	}
+	if err := checkBundleKey(c, bundle); err != nil {
+		return err
+	}
+
+	diff, err := s.db.DiffBundle(c.Request().Context(), bundle)
+	if err != nil {
+		return httpError(err)
+	}
+
+	return c.JSON(http.StatusOK, diff)
+}
+
+// PromoteHandler applies the selected changes of a bundle's diff.
+func (s *Server) PromoteHandler(c echo.Context) error {
+	promotion := new(model.Promotion)
+	if err := c.Bind(promotion); err != nil {
+		return err
+	}
+	if err := checkBundleKey(c, promotion.Bundle); err != nil {
+		return err
+	}
+
+	if isDryRun(c) {
+		return s.dryRun(c, func(ctx context.Context) error {
+			_, err := s.db.Promote(ctx, promotion)
+			return err
+		})
+	}
+
+	result, err := s.db.Promote(c.Request().Context(), promotion)
+	if err != nil {
+		return httpError(err)
+	}
+
+	return c.JSON(http.StatusOK, result)
+}
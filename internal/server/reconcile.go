@@ -0,0 +1,69 @@
+package server
+
+import (
+	"context"
+	"guardian/internal/model"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// reconcileManifest reads the manifest in the body for the application in
+// the URL, along with ?prune=.
+func reconcileManifest(c echo.Context) (*model.Manifest, bool, error) {
+	manifest, err := bindManifest(c)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := bindKey(&manifest.Application.ID, "application.id", c.Param("appID")); err != nil {
+		return nil, false, err
+	}
+	prune, _ := strconv.ParseBool(c.QueryParam("prune"))
+	return manifest, prune, nil
+}
+
+// PlanManifestHandler shows what reconciling the application with the
+// manifest in the body would change, and which managed entities drifted.
+func (s *Server) PlanManifestHandler(c echo.Context) error {
+	manifest, prune, err := reconcileManifest(c)
+	if err != nil {
+		return err
+	}
+	plan, err := s.db.PlanManifest(c.Request().Context(), manifest, prune)
+	if err != nil {
+		return httpError(err)
+	}
+
+	return c.JSON(http.StatusOK, plan)
+}
+
+func (s *Server) ApplyManifestHandler(c echo.Context) error {
+	manifest, prune, err := reconcileManifest(c)
+	if err != nil {
+		return err
+	}
+
+	if isDryRun(c) {
+		return s.dryRun(c, func(ctx context.Context) error {
+			_, err := s.db.ApplyManifest(ctx, manifest, prune)
+			return err
+		})
+	}
+
+	plan, err := s.db.ApplyManifest(c.Request().Context(), manifest, prune)
+	if err != nil {
+		return httpError(err)
+	}
+
+	return c.JSON(http.StatusOK, plan)
+}
+
+func (s *Server) GetDriftHandler(c echo.Context) error {
+	drift, err := s.db.DetectDrift(c.Request().Context(), c.Param("appID"))
+	if err != nil {
+		return httpError(err)
+	}
+
+	return c.JSON(http.StatusOK, drift)
+}
@@ -0,0 +1,272 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"guardian/internal/database"
+	"guardian/internal/mergepatch"
+	"guardian/internal/model"
+	"io"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// bindKey fills a key field left empty in the body from the URL and rejects
+// a body that names a different entity than the URL.
+func bindKey(field *string, name, value string) error {
+	if *field != "" && *field != value {
+		return echo.NewHTTPError(http.StatusBadRequest, name+" in body does not match the URL")
+	}
+	*field = value
+	return nil
+}
+
+// checkKey rejects a merge patch that changed a key field.
+func checkKey(field, name, value string) error {
+	if field != value {
+		return echo.NewHTTPError(http.StatusBadRequest, name+" cannot be changed")
+	}
+	return nil
+}
+
+// applyMergePatch applies the JSON Merge Patch in the request body to current
+// and decodes the result into patched.
+func applyMergePatch(c echo.Context, current, patched interface{}) error {
+	patch, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return err
+	}
+	doc, err := json.Marshal(current)
+	if err != nil {
+		return err
+	}
+	merged, err := mergepatch.Apply(doc, patch)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid merge patch: "+err.Error())
+	}
+	if err := json.Unmarshal(merged, patched); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "patched entity is invalid: "+err.Error())
+	}
+	return nil
+}
+
+// patchContext makes the write behind a PATCH fail if the entity changed
+// after it was read, unless the client already sent its own If-Match.
+func patchContext(c echo.Context, version int) context.Context {
+	ctx := c.Request().Context()
+	if match := c.Request().Header.Get("If-Match"); match == "" || match == "*" {
+		ctx = database.WithExpectedVersion(ctx, version)
+	}
+	return ctx
+}
+
+func (s *Server) ReplaceAppHandler(c echo.Context) error {
+	app := new(model.Application)
+	if err := c.Bind(app); err != nil {
+		return err
+	}
+	if err := bindKey(&app.ID, "id", c.Param("appID")); err != nil {
+		return err
+	}
+
+	return s.replaceApp(c.Request().Context(), c, app)
+}
+
+func (s *Server) PatchAppHandler(c echo.Context) error {
+	appID := c.Param("appID")
+	current, err := s.db.GetApp(c.Request().Context(), appID)
+	if err != nil {
+		return httpError(err)
+	}
+
+	app := new(model.Application)
+	if err := applyMergePatch(c, current, app); err != nil {
+		return err
+	}
+	if err := checkKey(app.ID, "id", appID); err != nil {
+		return err
+	}
+
+	return s.replaceApp(patchContext(c, current.Version), c, app)
+}
+
+func (s *Server) replaceApp(ctx context.Context, c echo.Context, app *model.Application) error {
+	if isDryRun(c) {
+		return s.dryRun(c, func(ctx context.Context) error {
+			return s.db.ReplaceApp(ctx, app)
+		})
+	}
+
+	if err := s.db.ReplaceApp(ctx, app); err != nil {
+		return httpError(err)
+	}
+	replaced, err := s.db.GetApp(ctx, app.ID)
+	if err != nil {
+		return httpError(err)
+	}
+	setETag(c, replaced.Version)
+
+	return c.JSON(http.StatusOK, replaced)
+}
+
+func (s *Server) ReplacePermHandler(c echo.Context) error {
+	perm := new(model.Permission)
+	if err := c.Bind(perm); err != nil {
+		return err
+	}
+	if err := bindKey(&perm.ID, "id", c.Param("permID")); err != nil {
+		return err
+	}
+	if err := bindKey(&perm.AppID, "app_id", c.Param("appID")); err != nil {
+		return err
+	}
+
+	return s.replacePerm(c.Request().Context(), c, perm)
+}
+
+func (s *Server) PatchPermHandler(c echo.Context) error {
+	permID := c.Param("permID")
+	appID := c.Param("appID")
+	current, err := s.db.GetPerm(c.Request().Context(), permID, appID)
+	if err != nil {
+		return httpError(err)
+	}
+
+	perm := new(model.Permission)
+	if err := applyMergePatch(c, current, perm); err != nil {
+		return err
+	}
+	if err := checkKey(perm.ID, "id", permID); err != nil {
+		return err
+	}
+	if err := checkKey(perm.AppID, "app_id", appID); err != nil {
+		return err
+	}
+
+	return s.replacePerm(patchContext(c, current.Version), c, perm)
+}
+
+func (s *Server) replacePerm(ctx context.Context, c echo.Context, perm *model.Permission) error {
+	if isDryRun(c) {
+		return s.dryRun(c, func(ctx context.Context) error {
+			return s.db.ReplacePerm(ctx, perm)
+		})
+	}
+
+	if err := s.db.ReplacePerm(ctx, perm); err != nil {
+		return httpError(err)
+	}
+	replaced, err := s.db.GetPerm(ctx, perm.ID, perm.AppID)
+	if err != nil {
+		return httpError(err)
+	}
+	setETag(c, replaced.Version)
+
+	return c.JSON(http.StatusOK, replaced)
+}
+
+func (s *Server) ReplaceRoleHandler(c echo.Context) error {
+	role := new(model.Role)
+	if err := c.Bind(role); err != nil {
+		return err
+	}
+	if err := bindKey(&role.ID, "id", c.Param("roleID")); err != nil {
+		return err
+	}
+	if err := bindKey(&role.AppID, "app_id", c.Param("appID")); err != nil {
+		return err
+	}
+
+	return s.replaceRole(c.Request().Context(), c, role)
+}
+
+func (s *Server) PatchRoleHandler(c echo.Context) error {
+	roleID := c.Param("roleID")
+	appID := c.Param("appID")
+	current, err := s.db.GetRole(c.Request().Context(), roleID, appID)
+	if err != nil {
+		return httpError(err)
+	}
+
+	role := new(model.Role)
+	if err := applyMergePatch(c, current, role); err != nil {
+		return err
+	}
+	if err := checkKey(role.ID, "id", roleID); err != nil {
+		return err
+	}
+	if err := checkKey(role.AppID, "app_id", appID); err != nil {
+		return err
+	}
+
+	return s.replaceRole(patchContext(c, current.Version), c, role)
+}
+
+func (s *Server) replaceRole(ctx context.Context, c echo.Context, role *model.Role) error {
+	if isDryRun(c) {
+		return s.dryRun(c, func(ctx context.Context) error {
+			return s.db.ReplaceRole(ctx, role)
+		})
+	}
+
+	if err := s.db.ReplaceRole(ctx, role); err != nil {
+		return httpError(err)
+	}
+	replaced, err := s.db.GetRole(ctx, role.ID, role.AppID)
+	if err != nil {
+		return httpError(err)
+	}
+	setETag(c, replaced.Version)
+
+	return c.JSON(http.StatusOK, replaced)
+}
+
+func (s *Server) ReplaceUserHandler(c echo.Context) error {
+	user := new(model.User)
+	if err := c.Bind(user); err != nil {
+		return err
+	}
+	if err := bindKey(&user.UserName, "username", c.Param("userName")); err != nil {
+		return err
+	}
+
+	return s.replaceUser(c.Request().Context(), c, user)
+}
+
+func (s *Server) PatchUserHandler(c echo.Context) error {
+	userName := c.Param("userName")
+	current, err := s.db.GetUser(c.Request().Context(), userName, nil)
+	if err != nil {
+		return httpError(err)
+	}
+
+	user := new(model.User)
+	if err := applyMergePatch(c, current, user); err != nil {
+		return err
+	}
+	if err := checkKey(user.UserName, "username", userName); err != nil {
+		return err
+	}
+
+	return s.replaceUser(patchContext(c, current.Version), c, user)
+}
+
+func (s *Server) replaceUser(ctx context.Context, c echo.Context, user *model.User) error {
+	if isDryRun(c) {
+		return s.dryRun(c, func(ctx context.Context) error {
+			return s.db.ReplaceUser(ctx, user)
+		})
+	}
+
+	if err := s.db.ReplaceUser(ctx, user); err != nil {
+		return httpError(err)
+	}
+	replaced, err := s.db.GetUser(ctx, user.UserName, nil)
+	if err != nil {
+		return httpError(err)
+	}
+	setETag(c, replaced.Version)
+
+	return c.JSON(http.StatusOK, replaced)
+}
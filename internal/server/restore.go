@@ -0,0 +1,86 @@
+package server
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+func (s *Server) RestoreAppHandler(c echo.Context) error {
+	appID := c.Param("appID")
+	if isDryRun(c) {
+		return s.dryRun(c, func(ctx context.Context) error {
+			return s.db.RestoreApp(ctx, appID)
+		})
+	}
+
+	if err := s.db.RestoreApp(c.Request().Context(), appID); err != nil {
+		return httpError(err)
+	}
+
+	resp := map[string]string{
+		"message": "ok",
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
+
+func (s *Server) RestorePermHandler(c echo.Context) error {
+	permID := c.Param("permID")
+	appID := c.Param("appID")
+	if isDryRun(c) {
+		return s.dryRun(c, func(ctx context.Context) error {
+			return s.db.RestorePerm(ctx, permID, appID)
+		})
+	}
+
+	if err := s.db.RestorePerm(c.Request().Context(), permID, appID); err != nil {
+		return httpError(err)
+	}
+
+	resp := map[string]string{
+		"message": "ok",
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
+
+func (s *Server) RestoreRoleHandler(c echo.Context) error {
+	roleID := c.Param("roleID")
+	appID := c.Param("appID")
+	if isDryRun(c) {
+		return s.dryRun(c, func(ctx context.Context) error {
+			return s.db.RestoreRole(ctx, roleID, appID)
+		})
+	}
+
+	if err := s.db.RestoreRole(c.Request().Context(), roleID, appID); err != nil {
+		return httpError(err)
+	}
+
+	resp := map[string]string{
+		"message": "ok",
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
+
+func (s *Server) RestoreUserHandler(c echo.Context) error {
+	userName := c.Param("userName")
+	if isDryRun(c) {
+		return s.dryRun(c, func(ctx context.Context) error {
+			return s.db.RestoreUser(ctx, userName)
+		})
+	}
+
+	if err := s.db.RestoreUser(c.Request().Context(), userName); err != nil {
+		return httpError(err)
+	}
+
+	resp := map[string]string{
+		"message": "ok",
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"guardian/internal/database"
+	"guardian/internal/filter"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// memberOptions collects the list parameters of a role's members. The
+// role fixes the application and members have no created_at, so the only
+// shorthands are name_prefix, on username, and assigned_from and
+// assigned_to.
+func memberOptions(c echo.Context) (*database.ListOptions, error) {
+	opts, err := pageOptions(c)
+	if err != nil {
+		return nil, err
+	}
+	expr, err := filterParam(c)
+	if err != nil {
+		return nil, err
+	}
+	exprs := []filter.Expr{expr}
+	if v := c.QueryParam("name_prefix"); v != "" {
+		exprs = append(exprs, filter.Compare{Field: "username", Op: filter.Sw, Value: v})
+	}
+	assigned, err := timeRange(c, "assigned_at", "assigned_from", "assigned_to")
+	if err != nil {
+		return nil, err
+	}
+	opts.Filter = filter.All(append(exprs, assigned...)...)
+	return opts, nil
+}
+
+// GetRoleMembersHandler lists the users assigned to a role, or with
+// ?count=true only counts them.
+func (s *Server) GetRoleMembersHandler(c echo.Context) error {
+	roleID := c.Param("roleID")
+	appID := c.Param("appID")
+	opts, err := memberOptions(c)
+	if err != nil {
+		return err
+	}
+
+	if count, _ := strconv.ParseBool(c.QueryParam("count")); count {
+		n, err := s.db.CountRoleMembers(c.Request().Context(), roleID, appID, opts)
+		if err != nil {
+			return httpError(err)
+		}
+		resp := map[string]int{
+			"count": n,
+		}
+
+		return c.JSON(http.StatusOK, resp)
+	}
+
+	members, next, err := s.db.GetRoleMembers(c.Request().Context(), roleID, appID, opts)
+	if err != nil {
+		return httpError(err)
+	}
+
+	return c.JSON(http.StatusOK, &listPage{Data: members, NextCursor: next})
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"context"
+	"guardian/internal/model"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+func (s *Server) AttachRolePermissionHandler(c echo.Context) error {
+	roleID := c.Param("roleID")
+	appID := c.Param("appID")
+	permID := c.Param("permID")
+	if isDryRun(c) {
+		return s.dryRun(c, func(ctx context.Context) error {
+			_, err := s.db.AttachRolePermission(ctx, roleID, appID, permID)
+			return err
+		})
+	}
+
+	changed, err := s.db.AttachRolePermission(c.Request().Context(), roleID, appID, permID)
+	if err != nil {
+		return httpError(err)
+	}
+
+	resp := map[string]interface{}{
+		"message": "ok",
+		"changed": changed,
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
+
+func (s *Server) DetachRolePermissionHandler(c echo.Context) error {
+	roleID := c.Param("roleID")
+	appID := c.Param("appID")
+	permID := c.Param("permID")
+	if isDryRun(c) {
+		return s.dryRun(c, func(ctx context.Context) error {
+			_, err := s.db.DetachRolePermission(ctx, roleID, appID, permID)
+			return err
+		})
+	}
+
+	changed, err := s.db.DetachRolePermission(c.Request().Context(), roleID, appID, permID)
+	if err != nil {
+		return httpError(err)
+	}
+
+	resp := map[string]interface{}{
+		"message": "ok",
+		"changed": changed,
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
+
+func (s *Server) UpdateRolePermissionsHandler(c echo.Context) error {
+	roleID := c.Param("roleID")
+	appID := c.Param("appID")
+	delta := new(model.RolePermissionDelta)
+	if err := c.Bind(delta); err != nil {
+		return err
+	}
+
+	if isDryRun(c) {
+		return s.dryRun(c, func(ctx context.Context) error {
+			_, err := s.db.UpdateRolePermissions(ctx, roleID, appID, delta)
+			return err
+		})
+	}
+
+	changes, err := s.db.UpdateRolePermissions(c.Request().Context(), roleID, appID, delta)
+	if err != nil {
+		return httpError(err)
+	}
+
+	return c.JSON(http.StatusOK, changes)
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+func versionParam(value string, name string) (int, error) {
+	version, err := strconv.Atoi(value)
+	if err != nil || version <= 0 {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid %s: %s", name, value))
+	}
+	return version, nil
+}
+
+func (s *Server) GetRoleVersionsHandler(c echo.Context) error {
+	roleID := c.Param("roleID")
+	appID := c.Param("appID")
+	versions, err := s.db.GetRoleVersions(c.Request().Context(), roleID, appID)
+	if err != nil {
+		return httpError(err)
+	}
+
+	return c.JSON(http.StatusOK, versions)
+}
+
+func (s *Server) GetRoleVersionHandler(c echo.Context) error {
+	roleID := c.Param("roleID")
+	appID := c.Param("appID")
+	version, err := versionParam(c.Param("version"), "version")
+	if err != nil {
+		return err
+	}
+	v, err := s.db.GetRoleVersion(c.Request().Context(), roleID, appID, version)
+	if err != nil {
+		return httpError(err)
+	}
+
+	return c.JSON(http.StatusOK, v)
+}
+
+func (s *Server) DiffRoleVersionsHandler(c echo.Context) error {
+	roleID := c.Param("roleID")
+	appID := c.Param("appID")
+	from, err := versionParam(c.QueryParam("from"), "from")
+	if err != nil {
+		return err
+	}
+	to, err := versionParam(c.QueryParam("to"), "to")
+	if err != nil {
+		return err
+	}
+	diff, err := s.db.DiffRoleVersions(c.Request().Context(), roleID, appID, from, to)
+	if err != nil {
+		return httpError(err)
+	}
+
+	return c.JSON(http.StatusOK, diff)
+}
+
+func (s *Server) RollbackRoleHandler(c echo.Context) error {
+	roleID := c.Param("roleID")
+	appID := c.Param("appID")
+	version, err := versionParam(c.Param("version"), "version")
+	if err != nil {
+		return err
+	}
+	if isDryRun(c) {
+		return s.dryRun(c, func(ctx context.Context) error {
+			_, err := s.db.RollbackRole(ctx, roleID, appID, version)
+			return err
+		})
+	}
+
+	role, err := s.db.RollbackRole(c.Request().Context(), roleID, appID, version)
+	if err != nil {
+		return httpError(err)
+	}
+
+	return c.JSON(http.StatusOK, role)
+}
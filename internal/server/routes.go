@@ -1,9 +1,10 @@
 package server
 
 import (
+	"context"
 	"guardian/internal/model"
 	"net/http"
-	"sync"
+	"net/url"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
@@ -11,31 +12,115 @@ import (
 
 func (s *Server) RegisterRoutes() http.Handler {
 	e := echo.New()
+	e.HTTPErrorHandler = problemHandler
 	e.Use(middleware.Logger())
 	e.Use(middleware.Recover())
+	e.Use(s.authMiddleware)
+	e.Use(ifMatchMiddleware)
 
 	e.GET("/", s.HelloWorldHandler)
 	e.GET("/health", s.healthHandler)
 
 	e.GET("/apps", s.GetAppsHandler)
 	e.GET("/apps/:appID", s.GetAppHandler)
-	e.POST("/apps", s.UpsertAppHandler)
+	e.POST("/apps", s.CreateAppHandler)
+	e.PUT("/apps/:appID", s.ReplaceAppHandler)
+	e.PATCH("/apps/:appID", s.PatchAppHandler)
 	e.DELETE("/apps/:appID", s.DeleteAppHandler)
+	e.POST("/apps/:appID/restore", s.RestoreAppHandler)
 
 	e.GET("/permissions", s.GetPermsHandler)
 	e.GET("/permissions/:permID/:appID", s.GetPermHandler)
-	e.POST("/permissions", s.UpsertPermHandler)
+	e.POST("/permissions", s.CreatePermHandler)
+	e.PUT("/permissions/:permID/:appID", s.ReplacePermHandler)
+	e.PATCH("/permissions/:permID/:appID", s.PatchPermHandler)
 	e.DELETE("/permissions/:permID/:appID", s.DeletePermHandler)
+	e.POST("/permissions/:permID/:appID/restore", s.RestorePermHandler)
 
 	e.GET("/roles", s.GetRolesHandler)
 	e.GET("/roles/:roleID/:appID", s.GetRoleHandler)
-	e.POST("/roles", s.UpsertRoleHandler)
+	e.POST("/roles", s.CreateRoleHandler)
+	e.PUT("/roles/:roleID/:appID", s.ReplaceRoleHandler)
+	e.PATCH("/roles/:roleID/:appID", s.PatchRoleHandler)
 	e.DELETE("/roles/:roleID/:appID", s.DeleteRoleHandler)
+	e.POST("/roles/:roleID/:appID/restore", s.RestoreRoleHandler)
+	e.PATCH("/roles/:roleID/:appID/permissions", s.UpdateRolePermissionsHandler)
+	e.PUT("/roles/:roleID/:appID/permissions/:permID", s.AttachRolePermissionHandler)
+	e.DELETE("/roles/:roleID/:appID/permissions/:permID", s.DetachRolePermissionHandler)
+	e.GET("/roles/:roleID/:appID/members", s.GetRoleMembersHandler)
+	e.GET("/roles/:roleID/:appID/versions", s.GetRoleVersionsHandler)
+	e.GET("/roles/:roleID/:appID/versions/diff", s.DiffRoleVersionsHandler)
+	e.GET("/roles/:roleID/:appID/versions/:version", s.GetRoleVersionHandler)
+	e.POST("/roles/:roleID/:appID/versions/:version/rollback", s.RollbackRoleHandler)
 
 	e.GET("/users", s.GetUsersHandler)
 	e.GET("/users/:userName", s.GetUserHandler)
-	e.POST("/users", s.UpsertUserHandler)
+	e.POST("/users", s.CreateUserHandler)
+	e.PUT("/users/:userName", s.ReplaceUserHandler)
+	e.PATCH("/users/:userName", s.PatchUserHandler)
 	e.DELETE("/users/:userName", s.DeleteUserHandler)
+	e.POST("/users/:userName/restore", s.RestoreUserHandler)
+	e.PUT("/users/:userName/roles/:roleID/:appID", s.GrantUserRoleHandler)
+	e.DELETE("/users/:userName/roles/:roleID/:appID", s.RevokeUserRoleHandler)
+	e.GET("/users/:userName/permissions", s.GetEffectivePermissionsHandler)
+	e.GET("/users/:userName/check", s.CheckPermissionHandler)
+
+	// The same resources nested under their application. Handlers read
+	// the same path parameters on both trees.
+	app := e.Group("/apps/:appID")
+	app.GET("/permissions", s.GetAppPermsHandler)
+	app.POST("/permissions", s.CreatePermHandler)
+	app.GET("/permissions/:permID", s.GetPermHandler)
+	app.PUT("/permissions/:permID", s.ReplacePermHandler)
+	app.PATCH("/permissions/:permID", s.PatchPermHandler)
+	app.DELETE("/permissions/:permID", s.DeletePermHandler)
+	app.POST("/permissions/:permID/restore", s.RestorePermHandler)
+
+	app.GET("/roles", s.GetAppRolesHandler)
+	app.POST("/roles", s.CreateRoleHandler)
+	app.GET("/roles/:roleID", s.GetRoleHandler)
+	app.PUT("/roles/:roleID", s.ReplaceRoleHandler)
+	app.PATCH("/roles/:roleID", s.PatchRoleHandler)
+	app.DELETE("/roles/:roleID", s.DeleteRoleHandler)
+	app.POST("/roles/:roleID/restore", s.RestoreRoleHandler)
+	app.GET("/roles/:roleID/permissions", s.GetRolePermsHandler)
+	app.PATCH("/roles/:roleID/permissions", s.UpdateRolePermissionsHandler)
+	app.PUT("/roles/:roleID/permissions/:permID", s.AttachRolePermissionHandler)
+	app.DELETE("/roles/:roleID/permissions/:permID", s.DetachRolePermissionHandler)
+	app.GET("/roles/:roleID/members", s.GetRoleMembersHandler)
+	app.GET("/roles/:roleID/versions", s.GetRoleVersionsHandler)
+	app.GET("/roles/:roleID/versions/diff", s.DiffRoleVersionsHandler)
+	app.GET("/roles/:roleID/versions/:version", s.GetRoleVersionHandler)
+	app.POST("/roles/:roleID/versions/:version/rollback", s.RollbackRoleHandler)
+
+	app.GET("/users", s.GetAppUsersHandler)
+
+	app.GET("/manifest", s.ExportManifestHandler)
+	app.PUT("/manifest", s.ImportManifestHandler)
+	app.POST("/reconcile/plan", s.PlanManifestHandler)
+	app.POST("/reconcile/apply", s.ApplyManifestHandler)
+	app.GET("/drift", s.GetDriftHandler)
+	app.GET("/bundle", s.ExportBundleHandler)
+	app.POST("/promotions/diff", s.DiffBundleHandler)
+	app.POST("/promotions", s.PromoteHandler)
+
+	e.GET("/search", s.SearchHandler)
+
+	e.GET("/audit", s.GetAuditLogsHandler)
+	e.GET("/audit/export", s.ExportAuditLogsHandler)
+	e.GET("/audit/verify", s.VerifyAuditLogsHandler)
+
+	e.GET("/assignments/export", s.ExportAssignmentsHandler)
+	e.POST("/assignments/import", s.ImportAssignmentsHandler)
+
+	e.GET("/casbin/model", s.CasbinModelHandler)
+	e.GET("/casbin/policy", s.ExportCasbinPolicyHandler)
+	e.POST("/casbin/policy", s.ImportCasbinPolicyHandler)
+
+	e.GET("/opa/bundle.tar.gz", s.OPABundleHandler)
+
+	e.POST("/keycloak/preview", s.PreviewKeycloakHandler)
+	e.POST("/keycloak/import", s.ImportKeycloakHandler)
 
 	return e
 }
@@ -52,36 +137,55 @@ func (s *Server) healthHandler(c echo.Context) error {
 	return c.JSON(http.StatusOK, s.db.Health())
 }
 
-func (s *Server) UpsertAppHandler(c echo.Context) error {
+func (s *Server) CreateAppHandler(c echo.Context) error {
 	app := new(model.Application)
 	if err := c.Bind(app); err != nil {
 		return err
 	}
 
-	if err := s.db.UpsertApp(c.Request().Context(), app); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	if isDryRun(c) {
+		return s.dryRun(c, func(ctx context.Context) error {
+			return s.db.CreateApp(ctx, app)
+		})
 	}
 
-	resp := map[string]string{
-		"message": "ok",
+	ctx := c.Request().Context()
+	if err := s.db.CreateApp(ctx, app); err != nil {
+		return httpError(err)
+	}
+	created, err := s.db.GetApp(ctx, app.ID)
+	if err != nil {
+		return httpError(err)
 	}
+	setETag(c, created.Version)
+	c.Response().Header().Set(echo.HeaderLocation, "/apps/"+url.PathEscape(app.ID))
 
-	return c.JSON(http.StatusOK, resp)
+	return c.JSON(http.StatusCreated, created)
 }
 
 func (s *Server) GetAppsHandler(c echo.Context) error {
-	apps, err := s.db.GetApps(c.Request().Context())
+	opts, err := listOptions(c, "id", "name")
+	if err != nil {
+		return err
+	}
+	apps, next, err := s.db.GetApps(c.Request().Context(), opts)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return httpError(err)
 	}
 
-	return c.JSON(http.StatusOK, apps)
+	return c.JSON(http.StatusOK, &listPage{Data: apps, NextCursor: next})
 }
 
 func (s *Server) DeleteAppHandler(c echo.Context) error {
 	appID := c.Param("appID")
+	if isDryRun(c) {
+		return s.dryRun(c, func(ctx context.Context) error {
+			return s.db.DeleteApp(ctx, appID)
+		})
+	}
+
 	if err := s.db.DeleteApp(c.Request().Context(), appID); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return httpError(err)
 	}
 
 	resp := map[string]string{
@@ -95,43 +199,68 @@ func (s *Server) GetAppHandler(c echo.Context) error {
 	appID := c.Param("appID")
 	app, err := s.db.GetApp(c.Request().Context(), appID)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return httpError(err)
 	}
+	setETag(c, app.Version)
 
 	return c.JSON(http.StatusOK, app)
 }
 
-func (s *Server) UpsertPermHandler(c echo.Context) error {
+func (s *Server) CreatePermHandler(c echo.Context) error {
 	perm := new(model.Permission)
 	if err := c.Bind(perm); err != nil {
 		return err
 	}
+	if appID := c.Param("appID"); appID != "" {
+		if err := bindKey(&perm.AppID, "app_id", appID); err != nil {
+			return err
+		}
+	}
 
-	if err := s.db.UpsertPerm(c.Request().Context(), perm); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	if isDryRun(c) {
+		return s.dryRun(c, func(ctx context.Context) error {
+			return s.db.CreatePerm(ctx, perm)
+		})
 	}
 
-	resp := map[string]string{
-		"message": "ok",
+	ctx := c.Request().Context()
+	if err := s.db.CreatePerm(ctx, perm); err != nil {
+		return httpError(err)
+	}
+	created, err := s.db.GetPerm(ctx, perm.ID, perm.AppID)
+	if err != nil {
+		return httpError(err)
 	}
+	setETag(c, created.Version)
+	c.Response().Header().Set(echo.HeaderLocation, permPath(c, perm.ID, perm.AppID))
 
-	return c.JSON(http.StatusOK, resp)
+	return c.JSON(http.StatusCreated, created)
 }
 
 func (s *Server) GetPermsHandler(c echo.Context) error {
-	perms, err := s.db.GetPerms(c.Request().Context())
+	opts, err := listOptions(c, "app_id", "name")
+	if err != nil {
+		return err
+	}
+	perms, next, err := s.db.GetPerms(c.Request().Context(), opts)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return httpError(err)
 	}
 
-	return c.JSON(http.StatusOK, perms)
+	return c.JSON(http.StatusOK, &listPage{Data: perms, NextCursor: next})
 }
 
 func (s *Server) DeletePermHandler(c echo.Context) error {
 	permID := c.Param("permID")
 	appID := c.Param("appID")
+	if isDryRun(c) {
+		return s.dryRun(c, func(ctx context.Context) error {
+			return s.db.DeletePerm(ctx, permID, appID)
+		})
+	}
+
 	if err := s.db.DeletePerm(c.Request().Context(), permID, appID); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return httpError(err)
 	}
 
 	resp := map[string]string{
@@ -146,48 +275,68 @@ func (s *Server) GetPermHandler(c echo.Context) error {
 	appID := c.Param("appID")
 	perm, err := s.db.GetPerm(c.Request().Context(), permID, appID)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return httpError(err)
 	}
+	setETag(c, perm.Version)
 
 	return c.JSON(http.StatusOK, perm)
 }
 
 func (s *Server) GetRolesHandler(c echo.Context) error {
-	appID := c.QueryParam("app_id")
-	args := new(sync.Map)
-	if appID != "" {
-		args.Store("app_id", appID)
+	opts, err := listOptions(c, "app_id", "name")
+	if err != nil {
+		return err
 	}
-	roles, err := s.db.GetRoles(c.Request().Context(), args)
+	roles, next, err := s.db.GetRoles(c.Request().Context(), opts)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return httpError(err)
 	}
 
-	return c.JSON(http.StatusOK, roles)
+	return c.JSON(http.StatusOK, &listPage{Data: roles, NextCursor: next})
 }
 
-func (s *Server) UpsertRoleHandler(c echo.Context) error {
+func (s *Server) CreateRoleHandler(c echo.Context) error {
 	role := new(model.Role)
 	if err := c.Bind(role); err != nil {
 		return err
 	}
+	if appID := c.Param("appID"); appID != "" {
+		if err := bindKey(&role.AppID, "app_id", appID); err != nil {
+			return err
+		}
+	}
 
-	if err := s.db.UpsertRole(c.Request().Context(), role); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	if isDryRun(c) {
+		return s.dryRun(c, func(ctx context.Context) error {
+			return s.db.CreateRole(ctx, role)
+		})
 	}
 
-	resp := map[string]string{
-		"message": "ok",
+	ctx := c.Request().Context()
+	if err := s.db.CreateRole(ctx, role); err != nil {
+		return httpError(err)
 	}
+	created, err := s.db.GetRole(ctx, role.ID, role.AppID)
+	if err != nil {
+		return httpError(err)
+	}
+	setETag(c, created.Version)
+	c.Response().Header().Set(echo.HeaderLocation, rolePath(c, role.ID, role.AppID))
 
-	return c.JSON(http.StatusOK, resp)
+	return c.JSON(http.StatusCreated, created)
 }
 
 func (s *Server) DeleteRoleHandler(c echo.Context) error {
 	roleID := c.Param("roleID")
 	appID := c.Param("appID")
+	if isDryRun(c) {
+		return s.dryRun(c, func(ctx context.Context) error {
+			return s.db.DeleteRole(ctx, roleID, appID)
+		})
+	}
+
 	if err := s.db.DeleteRole(c.Request().Context(), roleID, appID); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return httpError(err)
 	}
 
 	resp := map[string]string{
@@ -200,44 +349,82 @@ func (s *Server) DeleteRoleHandler(c echo.Context) error {
 func (s *Server) GetRoleHandler(c echo.Context) error {
 	roleID := c.Param("roleID")
 	appID := c.Param("appID")
-	role, err := s.db.GetRole(c.Request().Context(), roleID, appID)
+	asOf, err := asOfParam(c)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return err
+	}
+	var role *model.Role
+	if asOf != nil {
+		role, err = s.db.GetRoleAsOf(c.Request().Context(), roleID, appID, *asOf)
+	} else {
+		role, err = s.db.GetRole(c.Request().Context(), roleID, appID)
+	}
+	if err != nil {
+		return httpError(err)
+	}
+	// Historical snapshots are not the current representation and carry no
+	// ETag.
+	if asOf == nil {
+		setETag(c, role.Version)
 	}
 
 	return c.JSON(http.StatusOK, role)
 }
 
 func (s *Server) GetUsersHandler(c echo.Context) error {
-	users, err := s.db.GetUsers(c.Request().Context())
+	opts, err := listOptions(c, "app_id", "username")
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return err
+	}
+	view := userView(c)
+	users, next, err := s.db.GetUsers(c.Request().Context(), opts, view)
+	if err != nil {
+		return httpError(err)
+	}
+	data, err := sparse(users, view.Paths())
+	if err != nil {
+		return err
 	}
 
-	return c.JSON(http.StatusOK, users)
+	return c.JSON(http.StatusOK, &listPage{Data: data, NextCursor: next})
 }
 
-func (s *Server) UpsertUserHandler(c echo.Context) error {
+func (s *Server) CreateUserHandler(c echo.Context) error {
 	user := new(model.User)
 	if err := c.Bind(user); err != nil {
 		return err
 	}
 
-	if err := s.db.UpsertUser(c.Request().Context(), user); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	if isDryRun(c) {
+		return s.dryRun(c, func(ctx context.Context) error {
+			return s.db.CreateUser(ctx, user)
+		})
 	}
 
-	resp := map[string]string{
-		"message": "ok",
+	ctx := c.Request().Context()
+	if err := s.db.CreateUser(ctx, user); err != nil {
+		return httpError(err)
+	}
+	created, err := s.db.GetUser(ctx, user.UserName, nil)
+	if err != nil {
+		return httpError(err)
 	}
+	setETag(c, created.Version)
+	c.Response().Header().Set(echo.HeaderLocation, "/users/"+url.PathEscape(user.UserName))
 
-	return c.JSON(http.StatusOK, resp)
+	return c.JSON(http.StatusCreated, created)
 }
 
 func (s *Server) DeleteUserHandler(c echo.Context) error {
 	userName := c.Param("userName")
+	if isDryRun(c) {
+		return s.dryRun(c, func(ctx context.Context) error {
+			return s.db.DeleteUser(ctx, userName)
+		})
+	}
+
 	if err := s.db.DeleteUser(c.Request().Context(), userName); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return httpError(err)
 	}
 
 	resp := map[string]string{
@@ -249,10 +436,29 @@ func (s *Server) DeleteUserHandler(c echo.Context) error {
 
 func (s *Server) GetUserHandler(c echo.Context) error {
 	userName := c.Param("userName")
-	user, err := s.db.GetUser(c.Request().Context(), userName)
+	asOf, err := asOfParam(c)
+	if err != nil {
+		return err
+	}
+	// As-of snapshots are rebuilt from history in full and only trimmed
+	// for rendering.
+	view := userView(c)
+	var user *model.User
+	if asOf != nil {
+		user, err = s.db.GetUserAsOf(c.Request().Context(), userName, *asOf)
+	} else {
+		user, err = s.db.GetUser(c.Request().Context(), userName, view)
+	}
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return httpError(err)
+	}
+	if asOf == nil {
+		setETag(c, user.Version)
+	}
+	data, err := sparse(user, view.Paths())
+	if err != nil {
+		return err
 	}
 
-	return c.JSON(http.StatusOK, user)
+	return c.JSON(http.StatusOK, data)
 }
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultSearchLimit = 10
+	maxSearchLimit     = 50
+	maxSearchQuery     = 200
+)
+
+// SearchHandler searches every entity type at once. limit applies to each
+// type separately.
+func (s *Server) SearchHandler(c echo.Context) error {
+	query := strings.TrimSpace(c.QueryParam("q"))
+	if query == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "q is required")
+	}
+	if len(query) > maxSearchQuery {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("q must be at most %d bytes", maxSearchQuery))
+	}
+	limit := defaultSearchLimit
+	if v := c.QueryParam("limit"); v != "" {
+		var err error
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 || limit > maxSearchLimit {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxSearchLimit))
+		}
+	}
+
+	results, err := s.db.Search(c.Request().Context(), query, limit)
+	if err != nil {
+		return httpError(err)
+	}
+
+	return c.JSON(http.StatusOK, results)
+}
@@ -12,15 +12,17 @@ import (
 )
 
 type Server struct {
-	port int
-	db   database.Service
+	port   int
+	db     database.Service
+	tokens tokens
 }
 
 func NewServer() *http.Server {
 	port, _ := strconv.Atoi(os.Getenv("PORT"))
 	NewServer := &Server{
-		port: port,
-		db:   database.New(),
+		port:   port,
+		db:     database.New(),
+		tokens: parseTokens(os.Getenv("GUARDIAN_API_TOKENS")),
 	}
 
 	// Declare Server config
@@ -34,3 +36,10 @@ func NewServer() *http.Server {
 
 	return server
 }
+
+// NewHandler returns the routes of a server backed by db, authenticating
+// callers against GUARDIAN_API_TOKENS.
+func NewHandler(db database.Service) http.Handler {
+	s := &Server{db: db, tokens: parseTokens(os.Getenv("GUARDIAN_API_TOKENS"))}
+	return s.RegisterRoutes()
+}
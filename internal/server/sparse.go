@@ -0,0 +1,71 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"guardian/internal/database"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// userView reads ?expand= and the comma separated ?fields= of the user read
+// endpoints.
+func userView(c echo.Context) *database.UserView {
+	view := &database.UserView{Expand: c.QueryParam("expand")}
+	for _, field := range strings.Split(c.QueryParam("fields"), ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			view.Fields = append(view.Fields, field)
+		}
+	}
+	return view
+}
+
+// sparse renders v with only the dotted paths given, keeping everything if
+// there are none. Paths step through arrays, so "roles.id" keeps the id of
+// every role.
+func sparse(v interface{}, paths []string) (interface{}, error) {
+	if len(paths) == 0 {
+		return v, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return prune(doc, paths), nil
+}
+
+func prune(v interface{}, paths []string) interface{} {
+	switch v := v.(type) {
+	case []interface{}:
+		for i := range v {
+			v[i] = prune(v[i], paths)
+		}
+	case map[string]interface{}:
+		for key, val := range v {
+			var whole bool
+			var sub []string
+			for _, path := range paths {
+				if path == key {
+					whole = true
+				} else if strings.HasPrefix(path, key+".") {
+					sub = append(sub, strings.TrimPrefix(path, key+"."))
+				}
+			}
+			switch {
+			case whole:
+			case len(sub) > 0:
+				v[key] = prune(val, sub)
+			default:
+				delete(v, key)
+			}
+		}
+	}
+	return v
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+func (s *Server) GrantUserRoleHandler(c echo.Context) error {
+	userName := c.Param("userName")
+	roleID := c.Param("roleID")
+	appID := c.Param("appID")
+	if isDryRun(c) {
+		return s.dryRun(c, func(ctx context.Context) error {
+			_, err := s.db.GrantUserRole(ctx, userName, roleID, appID)
+			return err
+		})
+	}
+
+	changed, err := s.db.GrantUserRole(c.Request().Context(), userName, roleID, appID)
+	if err != nil {
+		return httpError(err)
+	}
+
+	resp := map[string]interface{}{
+		"message": "ok",
+		"changed": changed,
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
+
+func (s *Server) RevokeUserRoleHandler(c echo.Context) error {
+	userName := c.Param("userName")
+	roleID := c.Param("roleID")
+	appID := c.Param("appID")
+	if isDryRun(c) {
+		return s.dryRun(c, func(ctx context.Context) error {
+			_, err := s.db.RevokeUserRole(ctx, userName, roleID, appID)
+			return err
+		})
+	}
+
+	changed, err := s.db.RevokeUserRole(c.Request().Context(), userName, roleID, appID)
+	if err != nil {
+		return httpError(err)
+	}
+
+	resp := map[string]interface{}{
+		"message": "ok",
+		"changed": changed,
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
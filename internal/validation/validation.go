@@ -0,0 +1,178 @@
+// Package validation checks models before they are written. Limits follow
+// the database schema, where every identifier and text column is
+// VARCHAR(255).
+package validation
+
+import (
+	"fmt"
+	"guardian/internal/model"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxLength is the longest identifier, name or description, in characters.
+const MaxLength = 255
+
+// identifierRule is the character set of a kind of identifier. Identifiers
+// appear as URL path segments, so none allows "/" or whitespace.
+type identifierRule struct {
+	pattern     *regexp.Regexp
+	punctuation string
+}
+
+var (
+	entityID = identifierRule{regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._:-]*$`), `".", "_", ":" and "-"`}
+	userName = identifierRule{regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._@+-]*$`), `".", "_", "@", "+" and "-"`}
+)
+
+// FieldError describes one invalid field. Field is a JSON path such as
+// "permissions[1].app_id" and Code a stable identifier of the rule broken.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Errors lists every invalid field of a model.
+type Errors []*FieldError
+
+func (errs Errors) Error() string {
+	msgs := make([]string, 0, len(errs))
+	for _, err := range errs {
+		msgs = append(msgs, err.Field+": "+err.Message)
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (errs *Errors) add(field string, code string, format string, args ...interface{}) {
+	*errs = append(*errs, &FieldError{Field: field, Code: code, Message: fmt.Sprintf(format, args...)})
+}
+
+func (errs Errors) err() error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+func (errs *Errors) identifier(field string, value string, rule identifierRule) {
+	switch {
+	case value == "":
+		errs.add(field, "required", "is required")
+	case utf8.RuneCountInString(value) > MaxLength:
+		errs.add(field, "too_long", "must be at most %d characters", MaxLength)
+	case !rule.pattern.MatchString(value):
+		errs.add(field, "invalid_format", "must start with a letter or digit and contain only letters, digits, %s", rule.punctuation)
+	}
+}
+
+// reference checks an identifier that must name an existing row. Its format
+// was checked when that row was created, and rows older than the format
+// rules must stay referable, so only presence and length are checked.
+func (errs *Errors) reference(field string, value string) {
+	switch {
+	case value == "":
+		errs.add(field, "required", "is required")
+	case utf8.RuneCountInString(value) > MaxLength:
+		errs.add(field, "too_long", "must be at most %d characters", MaxLength)
+	}
+}
+
+func (errs *Errors) text(field string, value string, required bool) {
+	switch {
+	case required && strings.TrimSpace(value) == "":
+		errs.add(field, "required", "is required")
+	case utf8.RuneCountInString(value) > MaxLength:
+		errs.add(field, "too_long", "must be at most %d characters", MaxLength)
+	}
+}
+
+func Application(app *model.Application) error {
+	var errs Errors
+	errs.identifier("id", app.ID, entityID)
+	errs.text("name", app.Name, true)
+	errs.text("description", app.Description, false)
+	return errs.err()
+}
+
+func Permission(perm *model.Permission) error {
+	var errs Errors
+	errs.identifier("id", perm.ID, entityID)
+	errs.identifier("app_id", perm.AppID, entityID)
+	errs.text("name", perm.Name, true)
+	errs.text("description", perm.Description, false)
+	return errs.err()
+}
+
+// Role also requires every permission to belong to the role's application,
+// which is assumed for permissions that leave app_id empty, and to be listed
+// once.
+func Role(role *model.Role) error {
+	var errs Errors
+	errs.identifier("id", role.ID, entityID)
+	errs.identifier("app_id", role.AppID, entityID)
+	errs.text("name", role.Name, true)
+	errs.text("description", role.Description, false)
+
+	seen := make(map[string]bool, len(role.Permissions))
+	for i, perm := range role.Permissions {
+		field := fmt.Sprintf("permissions[%d]", i)
+		if perm == nil {
+			errs.add(field, "required", "must be an object")
+			continue
+		}
+		errs.reference(field+".id", perm.ID)
+		if perm.AppID != "" && perm.AppID != role.AppID {
+			errs.add(field+".app_id", "app_mismatch", "must match the role's application %q", role.AppID)
+		}
+		if seen[perm.ID] {
+			errs.add(field+".id", "duplicate", "permission %q is listed more than once", perm.ID)
+		}
+		seen[perm.ID] = true
+	}
+	return errs.err()
+}
+
+func User(user *model.User) error {
+	var errs Errors
+	errs.identifier("username", user.UserName, userName)
+
+	seen := make(map[[2]string]bool, len(user.Roles))
+	for i, role := range user.Roles {
+		field := fmt.Sprintf("roles[%d]", i)
+		if role == nil {
+			errs.add(field, "required", "must be an object")
+			continue
+		}
+		errs.reference(field+".id", role.ID)
+		errs.reference(field+".app_id", role.AppID)
+		key := [2]string{role.ID, role.AppID}
+		if seen[key] {
+			errs.add(field, "duplicate", "role %q of application %q is listed more than once", role.ID, role.AppID)
+		}
+		seen[key] = true
+	}
+	return errs.err()
+}
+
+// Except drops the errors of fields from err, which is returned by one of
+// the model checks. Updates use it to exempt values that are already stored,
+// so rows written before a rule existed stay editable.
+func Except(err error, fields ...string) error {
+	errs, ok := err.(Errors)
+	if !ok {
+		return err
+	}
+	var kept Errors
+	for _, e := range errs {
+		exempt := false
+		for _, field := range fields {
+			exempt = exempt || e.Field == field
+		}
+		if !exempt {
+			kept = append(kept, e)
+		}
+	}
+	return kept.err()
+}
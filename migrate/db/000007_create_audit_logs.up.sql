@@ -0,0 +1,26 @@
+CREATE TABLE audit_logs (
+  id BIGSERIAL PRIMARY KEY,
+  actor VARCHAR(255) NOT NULL,
+  action VARCHAR(32) NOT NULL,
+  entity VARCHAR(32) NOT NULL,
+  entity_id VARCHAR(255) NOT NULL,
+  app_id VARCHAR(255) NOT NULL DEFAULT '',
+  before JSONB,
+  after JSONB,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX audit_logs_entity_idx ON audit_logs (entity, entity_id, app_id);
+CREATE INDEX audit_logs_actor_idx ON audit_logs (actor);
+CREATE INDEX audit_logs_created_at_idx ON audit_logs (created_at);
+
+-- audit_logs is append-only: reject any attempt to rewrite or remove history.
+CREATE FUNCTION audit_logs_append_only() RETURNS trigger AS $$
+BEGIN
+  RAISE EXCEPTION 'audit_logs is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_logs_append_only
+  BEFORE UPDATE OR DELETE ON audit_logs
+  FOR EACH ROW EXECUTE FUNCTION audit_logs_append_only();
@@ -0,0 +1,12 @@
+CREATE OR REPLACE FUNCTION audit_logs_append_only() RETURNS trigger AS $$
+BEGIN
+  RAISE EXCEPTION 'audit_logs is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TABLE audit_checkpoints;
+
+ALTER TABLE audit_logs
+  DROP COLUMN seq,
+  DROP COLUMN prev_hash,
+  DROP COLUMN hash;
@@ -0,0 +1,34 @@
+ALTER TABLE audit_logs
+  ADD COLUMN seq BIGINT,
+  ADD COLUMN prev_hash VARCHAR(64) NOT NULL DEFAULT '',
+  ADD COLUMN hash VARCHAR(64) NOT NULL DEFAULT '';
+
+-- Entries written before chaining keep an empty hash and are reported as
+-- unchained by verification; they only receive a sequence number.
+ALTER TABLE audit_logs DISABLE TRIGGER audit_logs_append_only;
+UPDATE audit_logs SET seq = numbered.seq
+FROM (SELECT id, ROW_NUMBER() OVER (ORDER BY id) AS seq FROM audit_logs) AS numbered
+WHERE audit_logs.id = numbered.id;
+ALTER TABLE audit_logs ENABLE TRIGGER audit_logs_append_only;
+
+ALTER TABLE audit_logs ALTER COLUMN seq SET NOT NULL;
+ALTER TABLE audit_logs ADD CONSTRAINT audit_logs_seq_key UNIQUE (seq);
+
+-- Each checkpoint records the last entry removed by a retention run so the
+-- chain can still be verified from the oldest surviving entry.
+CREATE TABLE audit_checkpoints (
+  seq BIGINT PRIMARY KEY NOT NULL,
+  hash VARCHAR(64) NOT NULL,
+  archive VARCHAR(1024) NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Pruning is the only permitted removal and must opt in per transaction.
+CREATE OR REPLACE FUNCTION audit_logs_append_only() RETURNS trigger AS $$
+BEGIN
+  IF TG_OP = 'DELETE' AND current_setting('guardian.audit_prune', true) = 'on' THEN
+    RETURN OLD;
+  END IF;
+  RAISE EXCEPTION 'audit_logs is append-only';
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,30 @@
+CREATE TABLE role_versions (
+  role_id VARCHAR(255) NOT NULL,
+  app_id VARCHAR(255) NOT NULL,
+  version INT NOT NULL,
+  name VARCHAR(255) NOT NULL,
+  description VARCHAR(255) NOT NULL,
+  permission_ids JSONB NOT NULL DEFAULT '[]',
+  actor VARCHAR(255) NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (role_id, app_id, version)
+);
+
+-- Existing roles start their history at version 1.
+INSERT INTO role_versions (role_id, app_id, version, name, description, permission_ids, actor, created_at)
+SELECT
+  roles.id,
+  roles.app_id,
+  1,
+  roles.name,
+  roles.description,
+  COALESCE(jsonb_agg(role_permissions.permission_id ORDER BY role_permissions.permission_id) FILTER (WHERE role_permissions.permission_id IS NOT NULL), '[]'),
+  'migration',
+  roles.created_at
+FROM
+  roles
+LEFT JOIN
+  role_permissions ON roles.id = role_permissions.role_id AND roles.app_id = role_permissions.app_id
+GROUP BY
+  roles.id, roles.app_id, roles.name, roles.description, roles.created_at;
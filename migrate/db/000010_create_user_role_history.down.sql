@@ -0,0 +1,3 @@
+DROP TRIGGER user_role_history_track ON user_roles;
+DROP FUNCTION user_role_history_track;
+DROP TABLE user_role_history;
@@ -0,0 +1,45 @@
+CREATE TABLE user_role_history (
+  username VARCHAR(255) NOT NULL,
+  role_id VARCHAR(255) NOT NULL,
+  app_id VARCHAR(255) NOT NULL,
+  valid_from TIMESTAMP NOT NULL,
+  valid_to TIMESTAMP
+);
+
+CREATE INDEX user_role_history_username_idx ON user_role_history (username, valid_from);
+CREATE INDEX user_role_history_role_idx ON user_role_history (role_id, app_id, valid_from);
+CREATE UNIQUE INDEX user_role_history_open_idx ON user_role_history (username, role_id, app_id) WHERE valid_to IS NULL;
+
+-- Existing assignments are assumed to date from the user's last update.
+INSERT INTO user_role_history (username, role_id, app_id, valid_from)
+SELECT user_roles.username, user_roles.role_id, user_roles.app_id, users.updated_at
+FROM user_roles
+JOIN users ON users.username = user_roles.username;
+
+-- The history is kept by trigger so that cascaded deletes from users, roles
+-- and applications are captured as well. Replacing a user's roles deletes and
+-- re-inserts rows within one transaction; reopening the interval closed by
+-- that same transaction keeps such rewrites from fragmenting the history.
+CREATE FUNCTION user_role_history_track() RETURNS trigger AS $$
+BEGIN
+  IF TG_OP = 'INSERT' THEN
+    UPDATE user_role_history SET valid_to = NULL
+    WHERE username = NEW.username AND role_id = NEW.role_id AND app_id = NEW.app_id AND valid_to = LOCALTIMESTAMP;
+    IF NOT FOUND THEN
+      INSERT INTO user_role_history (username, role_id, app_id, valid_from)
+      VALUES (NEW.username, NEW.role_id, NEW.app_id, LOCALTIMESTAMP);
+    END IF;
+    RETURN NEW;
+  END IF;
+
+  DELETE FROM user_role_history
+  WHERE username = OLD.username AND role_id = OLD.role_id AND app_id = OLD.app_id AND valid_to IS NULL AND valid_from = LOCALTIMESTAMP;
+  UPDATE user_role_history SET valid_to = LOCALTIMESTAMP
+  WHERE username = OLD.username AND role_id = OLD.role_id AND app_id = OLD.app_id AND valid_to IS NULL;
+  RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER user_role_history_track
+  AFTER INSERT OR DELETE ON user_roles
+  FOR EACH ROW EXECUTE FUNCTION user_role_history_track();
@@ -0,0 +1,4 @@
+ALTER TABLE applications DROP COLUMN deleted_at;
+ALTER TABLE permissions DROP COLUMN deleted_at;
+ALTER TABLE roles DROP COLUMN deleted_at;
+ALTER TABLE users DROP COLUMN deleted_at;
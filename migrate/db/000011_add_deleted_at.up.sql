@@ -0,0 +1,9 @@
+ALTER TABLE applications ADD COLUMN deleted_at TIMESTAMP;
+ALTER TABLE permissions ADD COLUMN deleted_at TIMESTAMP;
+ALTER TABLE roles ADD COLUMN deleted_at TIMESTAMP;
+ALTER TABLE users ADD COLUMN deleted_at TIMESTAMP;
+
+CREATE INDEX applications_deleted_at_idx ON applications (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX permissions_deleted_at_idx ON permissions (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX roles_deleted_at_idx ON roles (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX users_deleted_at_idx ON users (deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,4 @@
+ALTER TABLE applications DROP COLUMN version;
+ALTER TABLE permissions DROP COLUMN version;
+ALTER TABLE roles DROP COLUMN version;
+ALTER TABLE users DROP COLUMN version;
@@ -0,0 +1,4 @@
+ALTER TABLE applications ADD COLUMN version INT NOT NULL DEFAULT 1;
+ALTER TABLE permissions ADD COLUMN version INT NOT NULL DEFAULT 1;
+ALTER TABLE roles ADD COLUMN version INT NOT NULL DEFAULT 1;
+ALTER TABLE users ADD COLUMN version INT NOT NULL DEFAULT 1;
@@ -0,0 +1,8 @@
+DROP INDEX users_updated_at_idx;
+DROP INDEX users_created_at_idx;
+DROP INDEX roles_created_at_idx;
+DROP INDEX permissions_created_at_idx;
+DROP INDEX applications_created_at_idx;
+DROP INDEX applications_name_idx;
+
+ALTER TABLE applications DROP COLUMN created_at;
@@ -0,0 +1,9 @@
+ALTER TABLE applications ADD COLUMN created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP;
+
+-- Keyset pagination orders by the sort column and then the primary key.
+CREATE INDEX applications_name_idx ON applications (name, id);
+CREATE INDEX applications_created_at_idx ON applications (created_at, id);
+CREATE INDEX permissions_created_at_idx ON permissions (created_at, app_id, id);
+CREATE INDEX roles_created_at_idx ON roles (created_at, app_id, id);
+CREATE INDEX users_created_at_idx ON users (created_at, username);
+CREATE INDEX users_updated_at_idx ON users (updated_at, username);
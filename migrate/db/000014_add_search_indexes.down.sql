@@ -0,0 +1,10 @@
+DROP INDEX users_search_trgm_idx;
+DROP INDEX roles_search_fts_idx;
+DROP INDEX roles_search_trgm_idx;
+DROP INDEX permissions_search_fts_idx;
+DROP INDEX permissions_search_trgm_idx;
+DROP INDEX applications_search_fts_idx;
+DROP INDEX applications_search_trgm_idx;
+
+-- pg_trgm stays installed: it may have been there before this migration
+-- and other objects may depend on it.
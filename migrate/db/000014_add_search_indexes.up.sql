@@ -0,0 +1,12 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- Search matches each entity's ID, name and description as one document,
+-- by substring and fuzzy trigram similarity and by English full text. The
+-- expressions must stay identical to the ones in internal/database/search.go.
+CREATE INDEX applications_search_trgm_idx ON applications USING GIN ((id || ' ' || name || ' ' || description) gin_trgm_ops);
+CREATE INDEX applications_search_fts_idx ON applications USING GIN (to_tsvector('english', id || ' ' || name || ' ' || description));
+CREATE INDEX permissions_search_trgm_idx ON permissions USING GIN ((id || ' ' || name || ' ' || description) gin_trgm_ops);
+CREATE INDEX permissions_search_fts_idx ON permissions USING GIN (to_tsvector('english', id || ' ' || name || ' ' || description));
+CREATE INDEX roles_search_trgm_idx ON roles USING GIN ((id || ' ' || name || ' ' || description) gin_trgm_ops);
+CREATE INDEX roles_search_fts_idx ON roles USING GIN (to_tsvector('english', id || ' ' || name || ' ' || description));
+CREATE INDEX users_search_trgm_idx ON users USING GIN (username gin_trgm_ops);
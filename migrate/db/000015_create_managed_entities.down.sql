@@ -0,0 +1 @@
+DROP TABLE managed_entities;
@@ -0,0 +1,12 @@
+-- Entities last written by reconciliation, with the version it left them
+-- at. A managed entity whose version has since moved on was edited outside
+-- of reconciliation and is reported as drift.
+CREATE TABLE managed_entities (
+  entity VARCHAR(255) NOT NULL,
+  id VARCHAR(255) NOT NULL,
+  app_id VARCHAR(255) NOT NULL REFERENCES applications (id) ON DELETE CASCADE,
+  version INT NOT NULL,
+  applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (app_id, entity, id)
+);
@@ -0,0 +1,5 @@
+DROP TRIGGER entity_history_track ON users;
+DROP TRIGGER entity_history_track ON roles;
+DROP TRIGGER entity_history_track ON permissions;
+DROP FUNCTION entity_history_track;
+DROP TABLE entity_history;
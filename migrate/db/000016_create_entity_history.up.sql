@@ -0,0 +1,81 @@
+-- The intervals in which each permission, role and user was visible, with
+-- the name and description it had during each. A new interval starts on
+-- creation, restore and rename; the open one ends on soft deletion. Rows
+-- outlive purges so that point-in-time reads stay answerable.
+CREATE TABLE entity_history (
+  entity VARCHAR(255) NOT NULL,
+  id VARCHAR(255) NOT NULL,
+  app_id VARCHAR(255) NOT NULL DEFAULT '',
+  name VARCHAR(255) NOT NULL DEFAULT '',
+  description VARCHAR(255) NOT NULL DEFAULT '',
+  valid_from TIMESTAMP NOT NULL,
+  valid_to TIMESTAMP
+);
+
+CREATE INDEX entity_history_key_idx ON entity_history (entity, app_id, id, valid_from);
+CREATE UNIQUE INDEX entity_history_open_idx ON entity_history (entity, app_id, id) WHERE valid_to IS NULL;
+
+-- Existing rows are assumed to have kept their current name since creation
+-- and, if deleted, to have been deleted once.
+INSERT INTO entity_history (entity, id, app_id, name, description, valid_from, valid_to)
+SELECT 'permission', id, app_id, name, description, created_at, deleted_at FROM permissions;
+INSERT INTO entity_history (entity, id, app_id, name, description, valid_from, valid_to)
+SELECT 'role', id, app_id, name, description, created_at, deleted_at FROM roles;
+INSERT INTO entity_history (entity, id, valid_from, valid_to)
+SELECT 'user', username, created_at, deleted_at FROM users;
+
+-- TG_ARGV[0] is the entity and TG_ARGV[1] the column holding its ID. Rows
+-- are read as JSON so that one function serves tables with and without
+-- app_id, name and description.
+CREATE FUNCTION entity_history_track() RETURNS trigger AS $$
+DECLARE
+  old_row JSONB;
+  new_row JSONB;
+  key_row JSONB;
+BEGIN
+  IF TG_OP <> 'INSERT' THEN
+    old_row := to_jsonb(OLD);
+  END IF;
+  IF TG_OP <> 'DELETE' THEN
+    new_row := to_jsonb(NEW);
+  END IF;
+  key_row := COALESCE(new_row, old_row);
+
+  IF old_row IS NOT NULL AND new_row IS NOT NULL
+    AND old_row -> 'deleted_at' IS NOT DISTINCT FROM new_row -> 'deleted_at'
+    AND old_row -> 'name' IS NOT DISTINCT FROM new_row -> 'name'
+    AND old_row -> 'description' IS NOT DISTINCT FROM new_row -> 'description' THEN
+    RETURN NULL;
+  END IF;
+
+  IF old_row IS NOT NULL AND old_row ->> 'deleted_at' IS NULL THEN
+    UPDATE entity_history SET valid_to = LOCALTIMESTAMP
+    WHERE entity = TG_ARGV[0]
+      AND id = key_row ->> TG_ARGV[1]
+      AND app_id = COALESCE(key_row ->> 'app_id', '')
+      AND valid_to IS NULL;
+  END IF;
+  IF new_row IS NOT NULL AND new_row ->> 'deleted_at' IS NULL THEN
+    INSERT INTO entity_history (entity, id, app_id, name, description, valid_from)
+    VALUES (
+      TG_ARGV[0],
+      key_row ->> TG_ARGV[1],
+      COALESCE(key_row ->> 'app_id', ''),
+      COALESCE(new_row ->> 'name', ''),
+      COALESCE(new_row ->> 'description', ''),
+      LOCALTIMESTAMP
+    );
+  END IF;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER entity_history_track
+  AFTER INSERT OR UPDATE OF name, description, deleted_at OR DELETE ON permissions
+  FOR EACH ROW EXECUTE FUNCTION entity_history_track('permission', 'id');
+CREATE TRIGGER entity_history_track
+  AFTER INSERT OR UPDATE OF name, description, deleted_at OR DELETE ON roles
+  FOR EACH ROW EXECUTE FUNCTION entity_history_track('role', 'id');
+CREATE TRIGGER entity_history_track
+  AFTER INSERT OR UPDATE OF deleted_at OR DELETE ON users
+  FOR EACH ROW EXECUTE FUNCTION entity_history_track('user', 'username');
@@ -0,0 +1,4 @@
+-- The field-level diff of before and after. It is derived from the hashed
+-- snapshots, so verification recomputes it instead of hashing it. Entries
+-- written before this column existed keep NULL.
+ALTER TABLE audit_logs ADD COLUMN changes JSONB;
@@ -0,0 +1,64 @@
+package tests
+
+import (
+	"encoding/json"
+	"guardian/internal/model"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNestedRoutes(t *testing.T) {
+	db := liveService(t)
+	appID := liveApp(t, db, "viewer")
+	otherID := liveApp(t, db, "viewer")
+	handler := authedHandler(t, db)
+
+	serve := func(method string, path string, body string) *httptest.ResponseRecorder {
+		req := authorize(httptest.NewRequest(method, path, strings.NewReader(body)), testToken)
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		return resp
+	}
+
+	resp := serve(http.MethodPost, "/apps/"+appID+"/roles", `{"id":"editor","name":"Editor","permissions":[{"id":"viewer"}]}`)
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("POST nested role = %d %s", resp.Code, resp.Body)
+	}
+	if loc := resp.Header().Get("Location"); loc != "/apps/"+appID+"/roles/editor" {
+		t.Errorf("Location = %q, want the nested path", loc)
+	}
+
+	nested := serve(http.MethodGet, "/apps/"+appID+"/roles/editor", "")
+	flat := serve(http.MethodGet, "/roles/editor/"+appID, "")
+	if nested.Code != http.StatusOK || nested.Body.String() != flat.Body.String() || nested.Header().Get("ETag") != flat.Header().Get("ETag") {
+		t.Errorf("nested GET = %d %s, flat GET = %d %s; want the same role", nested.Code, nested.Body, flat.Code, flat.Body)
+	}
+
+	var page struct {
+		Data []*model.Role `json:"data"`
+	}
+	resp = serve(http.MethodGet, "/apps/"+appID+"/roles", "")
+	if err := json.Unmarshal(resp.Body.Bytes(), &page); err != nil {
+		t.Fatalf("GET nested roles = %d %s", resp.Code, resp.Body)
+	}
+	for _, role := range page.Data {
+		if role.AppID != appID {
+			t.Errorf("nested list of %s includes role %s of %s", appID, role.ID, role.AppID)
+		}
+	}
+	if len(page.Data) != 2 {
+		t.Errorf("nested list = %d roles, want 2", len(page.Data))
+	}
+
+	if resp := serve(http.MethodPost, "/apps/"+appID+"/roles", `{"id":"other","app_id":"`+otherID+`","name":"Other"}`); resp.Code != http.StatusBadRequest {
+		t.Errorf("POST nested role of another app = %d, want 400", resp.Code)
+	}
+	if resp := serve(http.MethodGet, "/apps/missing-"+appID+"/roles", ""); resp.Code != http.StatusNotFound {
+		t.Errorf("GET roles of a missing app = %d, want 404", resp.Code)
+	}
+}
@@ -0,0 +1,213 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"guardian/internal/database"
+	"guardian/internal/filter"
+	"guardian/internal/model"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// assignmentStub records the rows an import hands to the database.
+type assignmentStub struct {
+	database.Service
+	rows []*model.AssignmentRow
+}
+
+func (s *assignmentStub) ImportAssignments(ctx context.Context, mode string, appID string, next func() (*model.AssignmentRow, error)) (*model.AssignmentImport, error) {
+	for {
+		row, err := next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		s.rows = append(s.rows, row)
+	}
+	return &model.AssignmentImport{Mode: mode, AppID: appID, Rows: len(s.rows)}, nil
+}
+
+func importCSV(t *testing.T, body string) (int, []*model.AssignmentRow) {
+	t.Helper()
+	stub := &assignmentStub{}
+	req := httptest.NewRequest(http.MethodPost, "/assignments/import", strings.NewReader(body))
+	resp := httptest.NewRecorder()
+	authedHandler(t, stub).ServeHTTP(resp, authorize(req, testToken))
+	return resp.Code, stub.rows
+}
+
+func TestAssignmentImportCSV(t *testing.T) {
+	cases := []struct {
+		name string
+		body string
+		rows []*model.AssignmentRow
+	}{
+		{
+			"reordered header",
+			"role_id,username,app_id\nadmin,alice,crm\n",
+			[]*model.AssignmentRow{{Row: 2, Assignment: model.Assignment{UserName: "alice", AppID: "crm", RoleID: "admin"}}},
+		},
+		{
+			"line numbers",
+			"username,app_id,role_id\nalice,crm,admin\n\nbob,crm,\"view\ner\"\ncarol,crm,viewer\n",
+			[]*model.AssignmentRow{
+				{Row: 2, Assignment: model.Assignment{UserName: "alice", AppID: "crm", RoleID: "admin"}},
+				{Row: 4, Assignment: model.Assignment{UserName: "bob", AppID: "crm", RoleID: "view\ner"}},
+				{Row: 6, Assignment: model.Assignment{UserName: "carol", AppID: "crm", RoleID: "viewer"}},
+			},
+		},
+		{
+			"short row",
+			"username,app_id,role_id\nalice,crm\n",
+			[]*model.AssignmentRow{{Row: 2, Assignment: model.Assignment{UserName: "alice", AppID: "crm"}}},
+		},
+	}
+
+	for _, tc := range cases {
+		status, rows := importCSV(t, tc.body)
+		if status != http.StatusOK {
+			t.Errorf("%s: status = %d, want %d", tc.name, status, http.StatusOK)
+		}
+		if !reflect.DeepEqual(rows, tc.rows) {
+			t.Errorf("%s: rows = %v, want %v", tc.name, rows, tc.rows)
+		}
+	}
+}
+
+func TestAssignmentImportCSVErrors(t *testing.T) {
+	for _, body := range []string{
+		"",
+		"username,app_id\nalice,crm\n",
+		"username,app_id,role_id\n\"alice,crm,admin\n",
+	} {
+		if status, _ := importCSV(t, body); status != http.StatusBadRequest {
+			t.Errorf("import of %q status = %d, want %d", body, status, http.StatusBadRequest)
+		}
+	}
+}
+
+func assignmentKeys(assignments []*model.Assignment) []string {
+	keys := make([]string, 0, len(assignments))
+	for _, a := range assignments {
+		keys = append(keys, a.UserName+" "+a.RoleID)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestAssignmentImportModes(t *testing.T) {
+	db := liveService(t)
+	ctx := liveContext()
+
+	cases := []struct {
+		mode    string
+		added   []string
+		removed []string
+	}{
+		{model.ImportAdd, []string{"alice r3"}, []string{}},
+		{model.ImportReplace, []string{"alice r3"}, []string{"alice r2"}},
+		{model.ImportSync, []string{"alice r3"}, []string{"alice r2", "bob r1"}},
+	}
+	for _, tc := range cases {
+		appID := liveApp(t, db, "r1", "r2", "r3")
+		alice := liveUser(t, db, appID, "alice", "r1", "r2")
+		liveUser(t, db, appID, "bob", "r1")
+
+		rows := []*model.AssignmentRow{
+			{Row: 2, Assignment: model.Assignment{UserName: alice, AppID: appID, RoleID: "r1"}},
+			{Row: 3, Assignment: model.Assignment{UserName: alice, AppID: appID, RoleID: "r3"}},
+		}
+		next := func() (*model.AssignmentRow, error) {
+			if len(rows) == 0 {
+				return nil, io.EOF
+			}
+			row := rows[0]
+			rows = rows[1:]
+			return row, nil
+		}
+		result, err := db.ImportAssignments(ctx, tc.mode, appID, next)
+		if err != nil {
+			t.Fatalf("ImportAssignments(%s) error = %v", tc.mode, err)
+		}
+		if len(result.Errors) > 0 {
+			t.Fatalf("ImportAssignments(%s) row errors = %v", tc.mode, result.Errors)
+		}
+
+		suffix := "@" + appID
+		trim := func(keys []string) []string {
+			for i := range keys {
+				keys[i] = strings.Replace(keys[i], suffix, "", 1)
+			}
+			return keys
+		}
+		if added := trim(assignmentKeys(result.Added)); !reflect.DeepEqual(added, tc.added) {
+			t.Errorf("ImportAssignments(%s) added = %v, want %v", tc.mode, added, tc.added)
+		}
+		if removed := trim(assignmentKeys(result.Removed)); !reflect.DeepEqual(removed, tc.removed) {
+			t.Errorf("ImportAssignments(%s) removed = %v, want %v", tc.mode, removed, tc.removed)
+		}
+	}
+}
+
+func TestAssignmentImportAudit(t *testing.T) {
+	db := liveService(t)
+	ctx := liveContext()
+	appID := liveApp(t, db, "r1", "r2")
+	alice := liveUser(t, db, appID, "alice")
+	bob := liveUser(t, db, appID, "bob", "r1")
+
+	rows := []*model.AssignmentRow{
+		{Row: 2, Assignment: model.Assignment{UserName: alice, AppID: appID, RoleID: "r1"}},
+		{Row: 3, Assignment: model.Assignment{UserName: alice, AppID: appID, RoleID: "r2"}},
+	}
+	next := func() (*model.AssignmentRow, error) {
+		if len(rows) == 0 {
+			return nil, io.EOF
+		}
+		row := rows[0]
+		rows = rows[1:]
+		return row, nil
+	}
+	if _, err := db.ImportAssignments(ctx, model.ImportSync, appID, next); err != nil {
+		t.Fatalf("ImportAssignments() error = %v", err)
+	}
+
+	logs, _, err := db.GetAuditLogs(ctx, &database.ListOptions{Filter: filter.All(
+		filter.Compare{Field: "app_id", Op: filter.Eq, Value: appID},
+		filter.Compare{Field: "action", Op: filter.Eq, Value: model.AuditActionImport},
+	)})
+	if err != nil {
+		t.Fatalf("GetAuditLogs() error = %v", err)
+	}
+	entries := make(map[string]json.RawMessage)
+	for _, log := range logs {
+		entries[log.EntityID] = log.After
+	}
+	if len(entries) != 3 {
+		t.Fatalf("import audit entries = %d, want a summary and one per user", len(logs))
+	}
+
+	var summary model.AssignmentImportSummary
+	if err := json.Unmarshal(entries[""], &summary); err != nil {
+		t.Fatal(err)
+	}
+	if summary.Users != 2 || summary.Added != 2 || summary.Removed != 1 {
+		t.Errorf("summary = %+v, want 2 users, 2 added, 1 removed", summary)
+	}
+	var changes model.UserAssignmentChanges
+	if err := json.Unmarshal(entries[bob], &changes); err != nil {
+		t.Fatal(err)
+	}
+	if len(changes.Added) != 0 || len(changes.Removed) != 1 || changes.Removed[0].RoleID != "r1" {
+		t.Errorf("changes of %s = %+v, want r1 removed", bob, changes)
+	}
+}
@@ -0,0 +1,142 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"guardian/internal/database"
+	"guardian/internal/model"
+	"testing"
+	"time"
+)
+
+func auditChain(t *testing.T, n int) []*model.AuditLog {
+	t.Helper()
+	logs := make([]*model.AuditLog, 0, n)
+	prev := ""
+	for i := 1; i <= n; i++ {
+		log := &model.AuditLog{
+			Seq:       int64(i),
+			Actor:     "alice",
+			Action:    model.AuditActionUpdate,
+			Entity:    model.EntityRole,
+			EntityID:  "admin",
+			AppID:     "crm",
+			Before:    json.RawMessage(`{"name": "Admin", "id": "admin"}`),
+			After:     json.RawMessage(`{"id":"admin","name":"Administrator"}`),
+			CreatedAt: model.Timestamp(time.Date(2024, 1, 2, 3, 4, 5, i*1000, time.UTC)),
+			PrevHash:  prev,
+		}
+		hash, err := database.AuditHash(prev, log)
+		if err != nil {
+			t.Fatalf("AuditHash() error = %v", err)
+		}
+		log.Hash = hash
+		prev = hash
+		logs = append(logs, log)
+	}
+	return logs
+}
+
+func verifyChain(t *testing.T, logs []*model.AuditLog) *model.AuditVerification {
+	t.Helper()
+	verifier := database.NewAuditVerifier(0, "")
+	for _, log := range logs {
+		if err := verifier.Add(log); err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+	}
+	return verifier.Result()
+}
+
+func TestAuditChainValid(t *testing.T) {
+	result := verifyChain(t, auditChain(t, 3))
+	if !result.Valid || result.Checked != 3 || result.LastSeq != 3 {
+		t.Errorf("verify() = %+v, want a valid chain of 3", result)
+	}
+}
+
+func TestAuditChainIgnoresJSONBFormatting(t *testing.T) {
+	logs := auditChain(t, 1)
+	// JSONB reorders keys and drops whitespace on the way back out.
+	logs[0].Before = json.RawMessage(`{"id":"admin","name":"Admin"}`)
+	if result := verifyChain(t, logs); !result.Valid {
+		t.Errorf("verify() problems = %+v", result.Problems)
+	}
+}
+
+func TestAuditChainDetectsTampering(t *testing.T) {
+	logs := auditChain(t, 3)
+	logs[1].Actor = "mallory"
+	result := verifyChain(t, logs)
+	if result.Valid || len(result.Problems) != 1 || result.Problems[0].Kind != model.AuditProblemHashMismatch {
+		t.Errorf("verify() problems = %+v, want one hash mismatch", result.Problems)
+	}
+}
+
+func TestAuditChainDetectsGap(t *testing.T) {
+	logs := auditChain(t, 3)
+	result := verifyChain(t, []*model.AuditLog{logs[0], logs[2]})
+	kinds := map[string]bool{}
+	for _, p := range result.Problems {
+		kinds[p.Kind] = true
+	}
+	if result.Valid || !kinds[model.AuditProblemGap] || !kinds[model.AuditProblemBrokenLink] {
+		t.Errorf("verify() problems = %+v, want gap and broken link", result.Problems)
+	}
+}
+
+func TestAuditArchiveRoundTrip(t *testing.T) {
+	var archive bytes.Buffer
+	for _, log := range auditChain(t, 3) {
+		if err := database.WriteAuditRecord(&archive, log); err != nil {
+			t.Fatalf("WriteAuditRecord() error = %v", err)
+		}
+	}
+
+	verifier := database.NewAuditVerifier(0, "")
+	if err := database.ReadAuditRecords(&archive, verifier.Add); err != nil {
+		t.Fatalf("ReadAuditRecords() error = %v", err)
+	}
+	if result := verifier.Result(); !result.Valid || result.Checked != 3 {
+		t.Errorf("verify() = %+v, want a valid chain of 3", result)
+	}
+}
+
+func TestAuditChanges(t *testing.T) {
+	cases := []struct {
+		name   string
+		before string
+		after  string
+		want   string
+	}{
+		{"update", `{"id": "admin", "name": "Admin"}`, `{"name":"Administrator","id":"admin"}`, `{"name":{"from":"Admin","to":"Administrator"}}`},
+		{"create", ``, `{"id":"admin"}`, `{"id":{"from":null,"to":"admin"}}`},
+		{"delete", `{"id":"admin"}`, `null`, `{"id":{"from":"admin","to":null}}`},
+		{"unchanged", `{"perms":["a","b"]}`, `{"perms": ["a", "b"]}`, `{}`},
+	}
+	for _, tc := range cases {
+		got, err := database.AuditChanges(json.RawMessage(tc.before), json.RawMessage(tc.after))
+		if err != nil {
+			t.Fatalf("%s: AuditChanges() error = %v", tc.name, err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("%s: AuditChanges() = %s, want %s", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestAuditChainDetectsChangesTampering(t *testing.T) {
+	logs := auditChain(t, 2)
+	for _, log := range logs {
+		changes, err := database.AuditChanges(log.Before, log.After)
+		if err != nil {
+			t.Fatalf("AuditChanges() error = %v", err)
+		}
+		log.Changes = changes
+	}
+	logs[1].Changes = json.RawMessage(`{"name":{"from":"Admin","to":"Owner"}}`)
+	result := verifyChain(t, logs)
+	if result.Valid || len(result.Problems) != 1 || result.Problems[0].Kind != model.AuditProblemChangesMismatch {
+		t.Errorf("verify() problems = %+v, want one changes mismatch", result.Problems)
+	}
+}
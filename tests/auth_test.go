@@ -0,0 +1,54 @@
+package tests
+
+import (
+	"guardian/internal/database"
+	"guardian/internal/server"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const testToken = "test-token"
+
+// authedHandler returns the routes of a server backed by db that accepts
+// testToken as the identity "test".
+func authedHandler(t *testing.T, db database.Service) http.Handler {
+	t.Helper()
+	t.Setenv("GUARDIAN_API_TOKENS", "test="+testToken)
+	return server.NewHandler(db)
+}
+
+func authorize(req *http.Request, token string) *http.Request {
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
+
+func TestAuthRequiredForChanges(t *testing.T) {
+	handler := authedHandler(t, emptyService(t))
+
+	cases := []struct {
+		name   string
+		req    *http.Request
+		status int
+	}{
+		{"anonymous read", httptest.NewRequest(http.MethodGet, "/", nil), http.StatusOK},
+		{"anonymous write", httptest.NewRequest(http.MethodPut, "/users/nobody/roles/r/app", nil), http.StatusUnauthorized},
+		{"invalid token", authorize(httptest.NewRequest(http.MethodGet, "/", nil), "wrong"), http.StatusUnauthorized},
+		{"basic auth", func() *http.Request {
+			req := httptest.NewRequest(http.MethodPut, "/users/nobody/roles/r/app", nil)
+			req.SetBasicAuth("test", testToken)
+			return req
+		}(), http.StatusUnauthorized},
+		{"valid token", authorize(httptest.NewRequest(http.MethodPut, "/users/nobody/roles/r/app", nil), testToken), http.StatusNotFound},
+	}
+	for _, tc := range cases {
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, tc.req)
+		if resp.Code != tc.status {
+			t.Errorf("%s: status = %d, want %d", tc.name, resp.Code, tc.status)
+		}
+		if resp.Code == http.StatusUnauthorized && resp.Header().Get("WWW-Authenticate") != "Bearer" {
+			t.Errorf("%s: WWW-Authenticate = %q, want Bearer", tc.name, resp.Header().Get("WWW-Authenticate"))
+		}
+	}
+}
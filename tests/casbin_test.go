@@ -0,0 +1,68 @@
+package tests
+
+import (
+	"bytes"
+	"guardian/internal/casbin"
+	"guardian/internal/model"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCasbinParse(t *testing.T) {
+	src := strings.Join([]string{
+		"# exported policy",
+		"p, admin, crm, contacts:write",
+		"",
+		"g, alice, admin, crm",
+		"g2, admin, superuser",
+		"p, admin, crm",
+		`p, "viewer", crm, " contacts:read "`,
+	}, "\n")
+	rules, unmapped, err := casbin.Parse(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantRules := []*model.CasbinRule{
+		{Line: 2, PType: "p", Subject: "admin", Domain: "crm", Object: "contacts:write"},
+		{Line: 4, PType: "g", Subject: "alice", Domain: "crm", Object: "admin"},
+		{Line: 7, PType: "p", Subject: "viewer", Domain: "crm", Object: "contacts:read"},
+	}
+	if !reflect.DeepEqual(rules, wantRules) {
+		for _, rule := range rules {
+			t.Logf("%+v", rule)
+		}
+		t.Errorf("unexpected rules")
+	}
+	if len(unmapped) != 2 || unmapped[0].Line != 5 || unmapped[1].Line != 6 {
+		for _, line := range unmapped {
+			t.Logf("%+v", line)
+		}
+		t.Errorf("unexpected unmapped lines")
+	}
+}
+
+func TestCasbinRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	w := casbin.NewWriter(&buf)
+	if err := w.Policy("admin", "crm", "contacts:write"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Grouping("alice", "admin", "crm"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	rules, unmapped, err := casbin.Parse(&buf)
+	if err != nil || len(unmapped) != 0 || len(rules) != 2 {
+		t.Fatalf("rules %v, unmapped %v, err %v", rules, unmapped, err)
+	}
+	for i, want := range []string{"p, admin, crm, contacts:write", "g, alice, admin, crm"} {
+		if got := casbin.Text(rules[i]); got != want {
+			t.Errorf("line %d: got %q, want %q", i+1, got, want)
+		}
+	}
+}
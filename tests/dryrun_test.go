@@ -0,0 +1,76 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"guardian/internal/database"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// emptyDriver is a database on which every query succeeds and finds nothing.
+type emptyDriver struct{}
+
+func (emptyDriver) Open(string) (driver.Conn, error) { return emptyConn{}, nil }
+
+type emptyConn struct{}
+
+func (emptyConn) Prepare(string) (driver.Stmt, error) { return emptyStmt{}, nil }
+func (emptyConn) Close() error                        { return nil }
+func (emptyConn) Begin() (driver.Tx, error)           { return emptyTx{}, nil }
+
+func (emptyConn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	return emptyTx{}, nil
+}
+
+type emptyTx struct{}
+
+func (emptyTx) Commit() error   { return nil }
+func (emptyTx) Rollback() error { return nil }
+
+type emptyStmt struct{}
+
+func (emptyStmt) Close() error                               { return nil }
+func (emptyStmt) NumInput() int                              { return -1 }
+func (emptyStmt) Exec([]driver.Value) (driver.Result, error) { return driver.RowsAffected(0), nil }
+func (emptyStmt) Query([]driver.Value) (driver.Rows, error)  { return emptyRows{}, nil }
+
+type emptyRows struct{}
+
+func (emptyRows) Columns() []string         { return nil }
+func (emptyRows) Close() error              { return nil }
+func (emptyRows) Next([]driver.Value) error { return io.EOF }
+
+func init() {
+	sql.Register("guardian-empty", emptyDriver{})
+}
+
+// emptyService is a Service on a database without any entities.
+func emptyService(t *testing.T) database.Service {
+	t.Helper()
+	db, err := sql.Open("guardian-empty", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return database.NewFromDB(db)
+}
+
+func TestDryRunStatusMatchesRealRun(t *testing.T) {
+	handler := authedHandler(t, emptyService(t))
+
+	for _, path := range []string{
+		"/users/nobody/roles/r/app",
+		"/users/nobody/roles/r/app?dry_run=true",
+	} {
+		req := authorize(httptest.NewRequest(http.MethodPut, path, nil), testToken)
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		if resp.Code != http.StatusNotFound {
+			t.Errorf("PUT %s status = %d, want %d", path, resp.Code, http.StatusNotFound)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package tests
+
+import (
+	"errors"
+	"guardian/internal/filter"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var roleFilterFields = filter.Fields{
+	"id":         {Column: "roles.id"},
+	"app_id":     {Column: "roles.app_id"},
+	"name":       {Column: "roles.name"},
+	"version":    {Column: "roles.version", Kind: filter.Int},
+	"created_at": {Column: "roles.created_at", Kind: filter.Time},
+	"permission_id": {
+		Column: "role_permissions.permission_id",
+		Exists: "SELECT 1 FROM role_permissions WHERE role_permissions.role_id = roles.id AND",
+	},
+}
+
+func TestFilterSQL(t *testing.T) {
+	cases := []struct {
+		src  string
+		sql  string
+		vals []interface{}
+	}{
+		{
+			`app_id eq "crm" and name sw "admin"`,
+			`(roles.app_id = ?) AND (roles.name LIKE ?)`,
+			[]interface{}{"crm", "admin%"},
+		},
+		{
+			`APP_ID Eq "crm" OR not (name co "50%_off")`,
+			`(roles.app_id = ?) OR (NOT (roles.name LIKE ?))`,
+			[]interface{}{"crm", `%50\%\_off%`},
+		},
+		{
+			`id eq "a" or id eq "b" and version ge 2`,
+			`(roles.id = ?) OR ((roles.id = ?) AND (roles.version >= ?))`,
+			[]interface{}{"a", "b", int64(2)},
+		},
+		{
+			`(id eq "a" or id eq "b") and name pr`,
+			`((roles.id = ?) OR (roles.id = ?)) AND (roles.name IS NOT NULL AND roles.name <> '')`,
+			[]interface{}{"a", "b"},
+		},
+		{
+			`permission_id ew ":write"`,
+			`EXISTS (SELECT 1 FROM role_permissions WHERE role_permissions.role_id = roles.id AND role_permissions.permission_id LIKE ?)`,
+			[]interface{}{"%:write"},
+		},
+		{
+			`name eq "x\" OR 1=1 --"`,
+			`roles.name = ?`,
+			[]interface{}{`x" OR 1=1 --`},
+		},
+		{
+			`created_at lt "2024-01-02T03:04:05Z"`,
+			`roles.created_at < CAST(?::timestamptz AS TIMESTAMP)`,
+			[]interface{}{time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+		},
+	}
+
+	for _, tc := range cases {
+		expr, err := filter.Parse(tc.src)
+		if err != nil {
+			t.Fatalf("Parse(%s) error = %v", tc.src, err)
+		}
+		sql, vals, err := roleFilterFields.SQL(expr)
+		if err != nil {
+			t.Fatalf("SQL(%s) error = %v", tc.src, err)
+		}
+		if sql != tc.sql {
+			t.Errorf("SQL(%s) = %s, want %s", tc.src, sql, tc.sql)
+		}
+		if !reflect.DeepEqual(vals, tc.vals) {
+			t.Errorf("SQL(%s) values = %#v, want %#v", tc.src, vals, tc.vals)
+		}
+	}
+}
+
+func TestFilterParseErrors(t *testing.T) {
+	for _, src := range []string{
+		``,
+		`name`,
+		`name eq`,
+		`name like "a"`,
+		`name eq "a" and`,
+		`(name eq "a"`,
+		`name eq "a")`,
+		`name eq "unterminated`,
+		`name eq 'a'`,
+		`name eq "a"; DROP TABLE roles`,
+	} {
+		_, err := filter.Parse(src)
+		var syntaxErr *filter.SyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("Parse(%q) error = %v, want a SyntaxError", src, err)
+		}
+	}
+}
+
+func TestFilterFieldErrors(t *testing.T) {
+	for _, src := range []string{
+		`password eq "x"`,
+		`roles.id eq "x"`,
+		`version eq "2"`,
+		`version eq 2.5`,
+		`version co 2`,
+		`name eq 2`,
+		`created_at sw "2024"`,
+		`created_at gt "yesterday"`,
+		`name gt null`,
+	} {
+		expr, err := filter.Parse(src)
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", src, err)
+		}
+		_, _, err = roleFilterFields.SQL(expr)
+		var fieldErr *filter.FieldError
+		if !errors.As(err, &fieldErr) {
+			t.Errorf("SQL(%q) error = %v, want a FieldError", src, err)
+		}
+	}
+}
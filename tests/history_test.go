@@ -0,0 +1,103 @@
+package tests
+
+import (
+	"errors"
+	"guardian/internal/database"
+	"guardian/internal/model"
+	"testing"
+	"time"
+)
+
+// instant returns a time strictly between the writes before and after it.
+func instant() time.Time {
+	time.Sleep(10 * time.Millisecond)
+	t := time.Now()
+	time.Sleep(10 * time.Millisecond)
+	return t
+}
+
+func TestRoleAsOfDeleteAndRestore(t *testing.T) {
+	db := liveService(t)
+	ctx := liveContext()
+	appID := liveApp(t, db, "viewer")
+
+	beforeDelete := instant()
+	if err := db.DeleteRole(ctx, "viewer", appID); err != nil {
+		t.Fatalf("DeleteRole() error = %v", err)
+	}
+	whileDeleted := instant()
+	if err := db.RestoreRole(ctx, "viewer", appID); err != nil {
+		t.Fatalf("RestoreRole() error = %v", err)
+	}
+	afterRestore := instant()
+
+	for _, asOf := range []time.Time{beforeDelete, afterRestore} {
+		if _, err := db.GetRoleAsOf(ctx, "viewer", appID, asOf); err != nil {
+			t.Errorf("GetRoleAsOf(%v) error = %v", asOf, err)
+		}
+	}
+	if _, err := db.GetRoleAsOf(ctx, "viewer", appID, whileDeleted); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("GetRoleAsOf() while deleted error = %v, want not found", err)
+	}
+}
+
+func TestRoleAsOfPermissionHistory(t *testing.T) {
+	db := liveService(t)
+	ctx := liveContext()
+	appID := liveApp(t, db, "viewer")
+
+	beforeRename := instant()
+	if err := db.ReplacePerm(ctx, &model.Permission{ID: "viewer", AppID: appID, Name: "Viewing"}); err != nil {
+		t.Fatalf("ReplacePerm() error = %v", err)
+	}
+	afterRename := instant()
+	if err := db.DeletePerm(ctx, "viewer", appID); err != nil {
+		t.Fatalf("DeletePerm() error = %v", err)
+	}
+	afterDelete := instant()
+
+	for asOf, want := range map[time.Time]string{beforeRename: "viewer", afterRename: "Viewing"} {
+		role, err := db.GetRoleAsOf(ctx, "viewer", appID, asOf)
+		if err != nil {
+			t.Fatalf("GetRoleAsOf() error = %v", err)
+		}
+		if len(role.Permissions) != 1 || role.Permissions[0].Name != want {
+			t.Errorf("GetRoleAsOf(%v) permissions = %+v, want one named %s", asOf, role.Permissions, want)
+		}
+	}
+	role, err := db.GetRoleAsOf(ctx, "viewer", appID, afterDelete)
+	if err != nil {
+		t.Fatalf("GetRoleAsOf() error = %v", err)
+	}
+	if len(role.Permissions) != 0 {
+		t.Errorf("GetRoleAsOf() after permission delete = %+v, want none", role.Permissions)
+	}
+}
+
+func TestUserAsOf(t *testing.T) {
+	db := liveService(t)
+	ctx := liveContext()
+	appID := liveApp(t, db, "viewer")
+
+	beforeCreate := instant()
+	alice := liveUser(t, db, appID, "alice", "viewer")
+	afterCreate := instant()
+	if err := db.DeleteUser(ctx, alice); err != nil {
+		t.Fatalf("DeleteUser() error = %v", err)
+	}
+	afterDelete := instant()
+
+	if _, err := db.GetUserAsOf(ctx, alice, beforeCreate); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("GetUserAsOf() before creation error = %v, want not found", err)
+	}
+	user, err := db.GetUserAsOf(ctx, alice, afterCreate)
+	if err != nil {
+		t.Fatalf("GetUserAsOf() error = %v", err)
+	}
+	if len(user.Roles) != 1 || user.Roles[0].ID != "viewer" {
+		t.Errorf("GetUserAsOf() roles = %+v, want [viewer]", user.Roles)
+	}
+	if _, err := db.GetUserAsOf(ctx, alice, afterDelete); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("GetUserAsOf() after deletion error = %v, want not found", err)
+	}
+}
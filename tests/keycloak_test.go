@@ -0,0 +1,115 @@
+package tests
+
+import (
+	"encoding/json"
+	"guardian/internal/keycloak"
+	"guardian/internal/model"
+	"reflect"
+	"testing"
+)
+
+const realmExport = `{
+	"realm": "acme",
+	"clients": [
+		{"clientId": "account"},
+		{"clientId": "crm", "name": "CRM"},
+		{"clientId": "bad client"}
+	],
+	"roles": {
+		"realm": [{"name": "offline_access"}],
+		"client": {
+			"crm": [
+				{"name": "read"},
+				{"name": "write"},
+				{"name": "editor", "composite": true, "composites": {"client": {"crm": ["read", "write"]}}},
+				{"name": "admin", "composite": true, "composites": {"realm": ["offline_access"], "client": {"crm": ["editor", "admin"]}}}
+			]
+		}
+	},
+	"groups": [
+		{"name": "sales", "path": "/sales", "clientRoles": {"crm": ["read"]}, "subGroups": [
+			{"name": "leads", "path": "/sales/leads", "clientRoles": {"crm": ["editor"]}}
+		]}
+	],
+	"users": [
+		{"username": "alice", "clientRoles": {"crm": ["admin"], "account": ["view-profile"]}},
+		{"username": "bob", "groups": ["/sales/leads"]},
+		{"username": "service-account-crm"}
+	]
+}`
+
+func TestKeycloakMap(t *testing.T) {
+	realm := new(keycloak.Realm)
+	if err := json.Unmarshal([]byte(realmExport), realm); err != nil {
+		t.Fatal(err)
+	}
+	imp := keycloak.Map(realm)
+
+	if len(imp.Manifests) != 1 {
+		t.Fatalf("Map() manifests = %d, want 1", len(imp.Manifests))
+	}
+	manifest := imp.Manifests[0]
+	if manifest.Application.ID != "crm" || manifest.Application.Name != "CRM" {
+		t.Errorf("Map() application = %+v", manifest.Application)
+	}
+	roles := make(map[string][]string)
+	for _, role := range manifest.Roles {
+		roles[role.ID] = role.Permissions
+	}
+	wantRoles := map[string][]string{
+		"read":   {"read"},
+		"write":  {"write"},
+		"editor": {"read", "write"},
+		"admin":  {"read", "write"},
+	}
+	if !reflect.DeepEqual(roles, wantRoles) {
+		t.Errorf("Map() roles = %v, want %v", roles, wantRoles)
+	}
+	if len(manifest.Permissions) != 2 {
+		t.Errorf("Map() permissions = %d, want 2", len(manifest.Permissions))
+	}
+
+	if !reflect.DeepEqual(imp.Users, []string{"alice", "bob"}) {
+		t.Errorf("Map() users = %v", imp.Users)
+	}
+	wantAssignments := []*model.Assignment{
+		{UserName: "alice", AppID: "crm", RoleID: "admin"},
+		{UserName: "bob", AppID: "crm", RoleID: "editor"},
+		{UserName: "bob", AppID: "crm", RoleID: "read"},
+	}
+	if !reflect.DeepEqual(imp.Assignments, wantAssignments) {
+		t.Errorf("Map() assignments = %v, want %v", imp.Assignments, wantAssignments)
+	}
+
+	skipped := make(map[string]bool)
+	for _, m := range imp.Report.Skipped {
+		skipped[m.Kind+" "+m.Source] = true
+	}
+	for _, want := range []string{"client account", "client bad client", "realm_role offline_access", "user service-account-crm"} {
+		if !skipped[want] {
+			t.Errorf("Map() did not report %s as skipped", want)
+		}
+	}
+	if imp.Report.Users != 2 || imp.Report.Assignments != 3 {
+		t.Errorf("Map() report counts = %d users, %d assignments", imp.Report.Users, imp.Report.Assignments)
+	}
+}
+
+func TestKeycloakMapSubgroupWithoutPath(t *testing.T) {
+	realm := new(keycloak.Realm)
+	err := json.Unmarshal([]byte(`{
+		"clients": [{"clientId": "crm"}],
+		"roles": {"client": {"crm": [{"name": "read"}]}},
+		"groups": [{"name": "sales", "subGroups": [{"name": "leads", "clientRoles": {"crm": ["read"]}}]}],
+		"users": [{"username": "bob", "groups": ["/sales/leads"]}]
+	}`), realm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	imp := keycloak.Map(realm)
+
+	want := []*model.Assignment{{UserName: "bob", AppID: "crm", RoleID: "read"}}
+	if !reflect.DeepEqual(imp.Assignments, want) {
+		t.Errorf("Map() assignments = %v, want %v", imp.Assignments, want)
+	}
+}
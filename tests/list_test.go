@@ -0,0 +1,63 @@
+package tests
+
+import (
+	"errors"
+	"guardian/internal/database"
+	"guardian/internal/filter"
+	"testing"
+)
+
+func TestAuditLogCursorRoundTrip(t *testing.T) {
+	db := liveService(t)
+	ctx := liveContext()
+	appID := liveApp(t, db, "a", "b", "c")
+	byApp := filter.Compare{Field: "app_id", Op: filter.Eq, Value: appID}
+
+	all, next, err := db.GetAuditLogs(ctx, &database.ListOptions{Filter: byApp})
+	if err != nil {
+		t.Fatalf("GetAuditLogs() error = %v", err)
+	}
+	if next != "" || len(all) < 6 {
+		t.Fatalf("GetAuditLogs() = %d entries, next %q; want every entry of %s", len(all), next, appID)
+	}
+
+	var seqs []int64
+	opts := &database.ListOptions{Filter: byApp, Limit: 2}
+	for {
+		logs, next, err := db.GetAuditLogs(ctx, opts)
+		if err != nil {
+			t.Fatalf("GetAuditLogs(cursor %q) error = %v", opts.Cursor, err)
+		}
+		for _, log := range logs {
+			seqs = append(seqs, log.Seq)
+		}
+		if next == "" {
+			break
+		}
+		opts.Cursor = next
+	}
+	if len(seqs) != len(all) {
+		t.Fatalf("paged %d entries, want %d", len(seqs), len(all))
+	}
+	for i, log := range all {
+		if seqs[i] != log.Seq {
+			t.Errorf("entry %d seq = %d, want %d", i, seqs[i], log.Seq)
+		}
+	}
+}
+
+func TestAuditLogCursorForOtherSort(t *testing.T) {
+	db := liveService(t)
+	ctx := liveContext()
+	appID := liveApp(t, db, "a", "b")
+	byApp := filter.Compare{Field: "app_id", Op: filter.Eq, Value: appID}
+
+	_, next, err := db.GetAuditLogs(ctx, &database.ListOptions{Filter: byApp, Limit: 1})
+	if err != nil || next == "" {
+		t.Fatalf("GetAuditLogs() next = %q, error = %v", next, err)
+	}
+	_, _, err = db.GetAuditLogs(ctx, &database.ListOptions{Filter: byApp, Sort: "seq", Cursor: next})
+	if !errors.Is(err, database.ErrValidation) {
+		t.Errorf("GetAuditLogs(sort seq, cursor for -seq) error = %v, want validation error", err)
+	}
+}
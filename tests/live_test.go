@@ -0,0 +1,65 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"guardian/internal/database"
+	"guardian/internal/model"
+	"os"
+	"testing"
+	"time"
+)
+
+// liveService returns a Service on the migrated database configured by the
+// DB_* variables, or skips the test when none is configured.
+func liveService(t *testing.T) database.Service {
+	t.Helper()
+	if os.Getenv("DB_HOST") == "" {
+		t.Skip("DB_HOST is not set")
+	}
+	return database.New()
+}
+
+// liveContext attributes the writes of a live test in the audit log, which
+// refuses writes without an actor.
+func liveContext() context.Context {
+	return database.WithActor(context.Background(), "test")
+}
+
+// liveApp creates an application with a unique ID and the given roles, each
+// granting a permission of the same ID.
+func liveApp(t *testing.T, db database.Service, roleIDs ...string) string {
+	t.Helper()
+	ctx := liveContext()
+	appID := fmt.Sprintf("test-%d", time.Now().UnixNano())
+	if err := db.CreateApp(ctx, &model.Application{ID: appID, Name: appID}); err != nil {
+		t.Fatalf("CreateApp() error = %v", err)
+	}
+	for _, id := range roleIDs {
+		perm := &model.Permission{ID: id, AppID: appID, Name: id}
+		if err := db.CreatePerm(ctx, perm); err != nil {
+			t.Fatalf("CreatePerm() error = %v", err)
+		}
+		role := &model.Role{ID: id, AppID: appID, Name: id, Permissions: []*model.Permission{perm}}
+		if err := db.CreateRole(ctx, role); err != nil {
+			t.Fatalf("CreateRole() error = %v", err)
+		}
+	}
+	return appID
+}
+
+// liveUser creates a user named after appID holding the given roles of it.
+func liveUser(t *testing.T, db database.Service, appID string, name string, roleIDs ...string) string {
+	t.Helper()
+	ctx := liveContext()
+	userName := name + "@" + appID
+	if err := db.CreateUser(ctx, &model.User{UserName: userName, Roles: make([]*model.Role, 0)}); err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	for _, id := range roleIDs {
+		if _, err := db.GrantUserRole(ctx, userName, id, appID); err != nil {
+			t.Fatalf("GrantUserRole() error = %v", err)
+		}
+	}
+	return userName
+}
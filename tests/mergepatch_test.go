@@ -0,0 +1,54 @@
+package tests
+
+import (
+	"encoding/json"
+	"guardian/internal/mergepatch"
+	"reflect"
+	"testing"
+)
+
+// Cases are taken from RFC 7396, appendix A.
+func TestMergePatchApply(t *testing.T) {
+	cases := []struct {
+		doc, patch, want string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	for _, tc := range cases {
+		got, err := mergepatch.Apply([]byte(tc.doc), []byte(tc.patch))
+		if err != nil {
+			t.Fatalf("Apply(%s, %s) error = %v", tc.doc, tc.patch, err)
+		}
+		var gotValue, wantValue interface{}
+		if err := json.Unmarshal(got, &gotValue); err != nil {
+			t.Fatalf("Apply(%s, %s) returned invalid JSON %s", tc.doc, tc.patch, got)
+		}
+		if err := json.Unmarshal([]byte(tc.want), &wantValue); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(gotValue, wantValue) {
+			t.Errorf("Apply(%s, %s) = %s, want %s", tc.doc, tc.patch, got, tc.want)
+		}
+	}
+}
+
+func TestMergePatchApplyInvalidPatch(t *testing.T) {
+	if _, err := mergepatch.Apply([]byte(`{}`), []byte(`{`)); err == nil {
+		t.Error("Apply() accepted a malformed patch")
+	}
+}
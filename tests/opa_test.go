@@ -0,0 +1,157 @@
+package tests
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"guardian/internal/database"
+	"guardian/internal/model"
+	"guardian/internal/opa"
+	"guardian/internal/server"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func opaFixture() *model.OPAData {
+	return &model.OPAData{
+		Apps:        map[string]*model.OPAApp{"crm": {Name: "CRM"}},
+		Permissions: map[string]map[string]*model.OPAPermission{"crm": {"contacts:read": {Name: "Read contacts"}}},
+		Roles:       map[string]map[string]*model.OPARole{"crm": {"viewer": {Name: "Viewer", Permissions: []string{"contacts:read"}}}},
+		UserRoles:   map[string]map[string][]string{"alice": {"crm": {"viewer"}}},
+	}
+}
+
+func readBundle(t *testing.T, b []byte) map[string][]byte {
+	t.Helper()
+	gz, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string][]byte)
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[hdr.Name] = body
+	}
+}
+
+func TestOPABundle(t *testing.T) {
+	bundle, err := opa.New(opaFixture(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := bundle.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	files := readBundle(t, buf.Bytes())
+
+	var manifest struct {
+		Revision string   `json:"revision"`
+		Roots    []string `json:"roots"`
+	}
+	if err := json.Unmarshal(files["/.manifest"], &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Revision != bundle.Revision || len(manifest.Roots) != 1 || manifest.Roots[0] != opa.Root {
+		t.Errorf("unexpected manifest %s", files["/.manifest"])
+	}
+	var data model.OPAData
+	if err := json.Unmarshal(files["/guardian/data.json"], &data); err != nil {
+		t.Fatal(err)
+	}
+	if roles := data.UserRoles["alice"]["crm"]; len(roles) != 1 || roles[0] != "viewer" {
+		t.Errorf("unexpected data %s", files["/guardian/data.json"])
+	}
+	if string(files["/guardian/authz.rego"]) != opa.Rego {
+		t.Errorf("missing Rego library")
+	}
+}
+
+func TestOPABundleRevision(t *testing.T) {
+	write := func(data *model.OPAData) (string, []byte) {
+		bundle, err := opa.New(data, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := bundle.Write(&buf); err != nil {
+			t.Fatal(err)
+		}
+		return bundle.Revision, buf.Bytes()
+	}
+
+	rev1, b1 := write(opaFixture())
+	rev2, b2 := write(opaFixture())
+	if rev1 != rev2 || !bytes.Equal(b1, b2) {
+		t.Errorf("equal data built different bundles")
+	}
+	if _, ok := readBundle(t, b1)["/guardian/authz.rego"]; ok {
+		t.Errorf("Rego library included without being asked for")
+	}
+
+	changed := opaFixture()
+	changed.UserRoles["bob"] = map[string][]string{"crm": {"viewer"}}
+	if rev3, _ := write(changed); rev3 == rev1 {
+		t.Errorf("revision did not change with the data")
+	}
+}
+
+// opaStub serves opaFixture at a fixed revision and counts data reads.
+type opaStub struct {
+	database.Service
+	reads int
+}
+
+func (s *opaStub) OPARevision(ctx context.Context) (string, error) {
+	return "7", nil
+}
+
+func (s *opaStub) OPAData(ctx context.Context) (*model.OPAData, error) {
+	s.reads++
+	data := opaFixture()
+	data.Revision = "7"
+	return data, nil
+}
+
+func TestOPABundleNotModified(t *testing.T) {
+	stub := &opaStub{}
+	handler := server.NewHandler(stub)
+
+	req := httptest.NewRequest(http.MethodGet, "/opa/bundle.tar.gz", nil)
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK || resp.Header().Get("ETag") != `"7"` || stub.reads != 1 {
+		t.Fatalf("GET = %d, ETag %s, %d reads; want 200, \"7\", 1 read", resp.Code, resp.Header().Get("ETag"), stub.reads)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/opa/bundle.tar.gz", nil)
+	req.Header.Set("If-None-Match", `"7"`)
+	resp = httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+	if resp.Code != http.StatusNotModified || stub.reads != 1 {
+		t.Errorf("conditional GET = %d after %d reads, want 304 without reading the data", resp.Code, stub.reads)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/opa/bundle.tar.gz?rego=true", nil)
+	req.Header.Set("If-None-Match", `"7"`)
+	resp = httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK || resp.Header().Get("ETag") != `"7-rego"` {
+		t.Errorf("GET with Rego = %d, ETag %s; want 200, \"7-rego\"", resp.Code, resp.Header().Get("ETag"))
+	}
+}
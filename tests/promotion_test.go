@@ -0,0 +1,96 @@
+package tests
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"guardian/internal/database"
+	"guardian/internal/model"
+	"strings"
+	"testing"
+)
+
+// promotionBundle exports a small manifest and reads it back the way a
+// target instance receives it.
+func promotionBundle(t *testing.T) *model.Bundle {
+	t.Helper()
+	t.Setenv("GUARDIAN_BUNDLE_KEY", "shared-secret")
+	exported, err := database.NewBundle(&model.Manifest{
+		Version:     model.ManifestVersion,
+		Application: model.ManifestApplication{ID: "crm", Name: "CRM"},
+		Permissions: []*model.ManifestPermission{{ID: "read", Name: "Read"}},
+		Roles:       []*model.ManifestRole{{ID: "viewer", Name: "Viewer", Permissions: []string{"read"}}},
+	})
+	if err != nil {
+		t.Fatalf("NewBundle() error = %v", err)
+	}
+	data, err := json.Marshal(exported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle := new(model.Bundle)
+	if err := json.Unmarshal(data, bundle); err != nil {
+		t.Fatal(err)
+	}
+	return bundle
+}
+
+func TestBundleRoundTrip(t *testing.T) {
+	diff, err := emptyService(t).DiffBundle(context.Background(), promotionBundle(t))
+	if err != nil {
+		t.Fatalf("DiffBundle() error = %v", err)
+	}
+	if len(diff.Changes) != 3 {
+		t.Errorf("DiffBundle() changes = %d, want 3", len(diff.Changes))
+	}
+}
+
+func TestBundleTampered(t *testing.T) {
+	bundle := promotionBundle(t)
+	bundle.Manifest.Roles[0].Permissions = append(bundle.Manifest.Roles[0].Permissions, "write")
+	_, err := emptyService(t).DiffBundle(context.Background(), bundle)
+	if !errors.Is(err, database.ErrValidation) {
+		t.Errorf("DiffBundle() error = %v, want a validation error", err)
+	}
+}
+
+func TestBundleForged(t *testing.T) {
+	bundle := promotionBundle(t)
+	bundle.Manifest.Roles[0].Permissions = append(bundle.Manifest.Roles[0].Permissions, "write")
+	data, err := json.Marshal(bundle.Manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(data)
+	bundle.Digest = hex.EncodeToString(sum[:])
+
+	_, err = emptyService(t).DiffBundle(context.Background(), bundle)
+	if !errors.Is(err, database.ErrValidation) || !strings.Contains(err.Error(), "signature") {
+		t.Errorf("DiffBundle() error = %v, want a signature validation error", err)
+	}
+}
+
+func TestBundleOtherKey(t *testing.T) {
+	bundle := promotionBundle(t)
+	t.Setenv("GUARDIAN_BUNDLE_KEY", "another-secret")
+	_, err := emptyService(t).DiffBundle(context.Background(), bundle)
+	if !errors.Is(err, database.ErrValidation) {
+		t.Errorf("DiffBundle() error = %v, want a validation error", err)
+	}
+}
+
+func TestPromoteUnpendingChange(t *testing.T) {
+	promotion := &model.Promotion{
+		Bundle: promotionBundle(t),
+		Select: []*model.ChangeRef{
+			{Entity: model.EntityRole, ID: "viewer"},
+			{Entity: model.EntityRole, ID: "admin"},
+		},
+	}
+	_, err := emptyService(t).Promote(context.Background(), promotion)
+	if !errors.Is(err, database.ErrValidation) || !strings.Contains(err.Error(), "role admin") {
+		t.Errorf("Promote() error = %v, want a validation error naming role admin", err)
+	}
+}
@@ -0,0 +1,87 @@
+package tests
+
+import (
+	"errors"
+	"guardian/internal/database"
+	"guardian/internal/model"
+	"reflect"
+	"testing"
+)
+
+// changeKeys flattens a plan into "action entity id" strings, in plan order.
+func changeKeys(changes []*model.ManifestChange) []string {
+	keys := make([]string, 0, len(changes))
+	for _, c := range changes {
+		keys = append(keys, c.Action+" "+c.Entity+" "+c.ID)
+	}
+	return keys
+}
+
+func TestReconcilePlanPruneDrift(t *testing.T) {
+	db := liveService(t)
+	ctx := liveContext()
+	appID := liveApp(t, db, "read", "write")
+	manifest := &model.Manifest{
+		Version:     model.ManifestVersion,
+		Application: model.ManifestApplication{ID: appID, Name: appID},
+		Permissions: []*model.ManifestPermission{{ID: "read", Name: "Read"}},
+		Roles: []*model.ManifestRole{
+			{ID: "read", Name: "read", Permissions: []string{"read"}},
+			{ID: "reader", Name: "Reader", Permissions: []string{"read"}},
+		},
+	}
+
+	plan, err := db.PlanManifest(ctx, manifest, false)
+	if err != nil {
+		t.Fatalf("PlanManifest() error = %v", err)
+	}
+	want := []string{"update permission read", "create role reader"}
+	if got := changeKeys(plan.Changes); !reflect.DeepEqual(got, want) {
+		t.Errorf("PlanManifest() = %v, want %v", got, want)
+	}
+
+	pruned, err := db.PlanManifest(ctx, manifest, true)
+	if err != nil {
+		t.Fatalf("PlanManifest(prune) error = %v", err)
+	}
+	want = append(want, "delete role write", "delete permission write")
+	if got := changeKeys(pruned.Changes); !reflect.DeepEqual(got, want) {
+		t.Errorf("PlanManifest(prune) = %v, want %v", got, want)
+	}
+
+	applied, err := db.ApplyManifest(ctx, manifest, true)
+	if err != nil {
+		t.Fatalf("ApplyManifest() error = %v", err)
+	}
+	if !applied.Applied || !reflect.DeepEqual(changeKeys(applied.Changes), want) {
+		t.Errorf("ApplyManifest() = %+v, want the pruned plan applied", applied)
+	}
+	if _, err := db.GetPerm(ctx, "write", appID); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("GetPerm(write) error = %v, want the pruned permission gone", err)
+	}
+	if again, err := db.PlanManifest(ctx, manifest, true); err != nil || len(again.Changes) != 0 || len(again.Drift) != 0 {
+		t.Errorf("PlanManifest() after apply = %+v, %v; want nothing to do", again, err)
+	}
+
+	perm := &model.Permission{ID: "read", AppID: appID, Name: "Edited"}
+	if err := db.ReplacePerm(ctx, perm); err != nil {
+		t.Fatalf("ReplacePerm() error = %v", err)
+	}
+	if err := db.DeleteRole(ctx, "reader", appID); err != nil {
+		t.Fatalf("DeleteRole() error = %v", err)
+	}
+	drift, err := db.DetectDrift(ctx, appID)
+	if err != nil {
+		t.Fatalf("DetectDrift() error = %v", err)
+	}
+	if len(drift) != 2 {
+		t.Fatalf("DetectDrift() = %d entries, want 2", len(drift))
+	}
+	edited, deleted := drift[0], drift[1]
+	if edited.Entity != model.EntityPermission || edited.ID != "read" || edited.Deleted || edited.CurrentVersion != edited.ManagedVersion+1 {
+		t.Errorf("drift of the edited permission = %+v", edited)
+	}
+	if deleted.Entity != model.EntityRole || deleted.ID != "reader" || !deleted.Deleted {
+		t.Errorf("drift of the deleted role = %+v", deleted)
+	}
+}
@@ -0,0 +1,67 @@
+package tests
+
+import (
+	"errors"
+	"guardian/internal/database"
+	"guardian/internal/model"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func rolePermIDs(t *testing.T, db database.Service, roleID string, appID string) []string {
+	t.Helper()
+	role, err := db.GetRole(liveContext(), roleID, appID)
+	if err != nil {
+		t.Fatalf("GetRole() error = %v", err)
+	}
+	ids := make([]string, 0, len(role.Permissions))
+	for _, perm := range role.Permissions {
+		ids = append(ids, perm.ID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestUpdateRolePermissions(t *testing.T) {
+	db := liveService(t)
+	ctx := liveContext()
+	appID := liveApp(t, db, "admin", "read", "write")
+
+	changes, err := db.UpdateRolePermissions(ctx, "admin", appID, &model.RolePermissionDelta{
+		Add:    []string{"read", "write", "admin"},
+		Remove: []string{"missing"},
+	})
+	if err != nil {
+		t.Fatalf("UpdateRolePermissions() error = %v", err)
+	}
+	want := &model.RolePermissionChanges{Added: []string{"read", "write"}, Removed: []string{}}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("UpdateRolePermissions() = %+v, want %+v", changes, want)
+	}
+	if ids := rolePermIDs(t, db, "admin", appID); !reflect.DeepEqual(ids, []string{"admin", "read", "write"}) {
+		t.Errorf("permissions = %v after adding", ids)
+	}
+
+	versions, err := db.GetRoleVersions(ctx, "admin", appID)
+	if err != nil {
+		t.Fatalf("GetRoleVersions() error = %v", err)
+	}
+	unchanged, err := db.UpdateRolePermissions(ctx, "admin", appID, &model.RolePermissionDelta{Add: []string{"read"}})
+	if err != nil || len(unchanged.Added) != 0 || len(unchanged.Removed) != 0 {
+		t.Errorf("UpdateRolePermissions(no-op) = %+v, %v; want no changes", unchanged, err)
+	}
+	if after, _ := db.GetRoleVersions(ctx, "admin", appID); len(after) != len(versions) {
+		t.Errorf("no-op delta recorded a revision: %d versions, want %d", len(after), len(versions))
+	}
+
+	if _, err := db.UpdateRolePermissions(ctx, "admin", appID, &model.RolePermissionDelta{Add: []string{"read"}, Remove: []string{"read"}}); !errors.Is(err, database.ErrValidation) {
+		t.Errorf("UpdateRolePermissions(add and remove) error = %v, want ErrValidation", err)
+	}
+	if _, err := db.UpdateRolePermissions(ctx, "admin", appID, &model.RolePermissionDelta{Remove: []string{"write"}, Add: []string{"missing"}}); !errors.Is(err, database.ErrInvalidReference) {
+		t.Errorf("UpdateRolePermissions(missing permission) error = %v, want ErrInvalidReference", err)
+	}
+	if ids := rolePermIDs(t, db, "admin", appID); !reflect.DeepEqual(ids, []string{"admin", "read", "write"}) {
+		t.Errorf("permissions = %v, want a failed delta to change nothing", ids)
+	}
+}
@@ -0,0 +1,71 @@
+package tests
+
+import (
+	"errors"
+	"guardian/internal/database"
+	"guardian/internal/model"
+	"reflect"
+	"testing"
+)
+
+func TestRoleVersions(t *testing.T) {
+	db := liveService(t)
+	ctx := liveContext()
+	appID := liveApp(t, db, "viewer", "editor")
+
+	role := &model.Role{
+		ID:          "viewer",
+		AppID:       appID,
+		Name:        "Viewers",
+		Permissions: []*model.Permission{{ID: "viewer", AppID: appID}, {ID: "editor", AppID: appID}},
+	}
+	if err := db.ReplaceRole(ctx, role); err != nil {
+		t.Fatalf("ReplaceRole() error = %v", err)
+	}
+
+	diff, err := db.DiffRoleVersions(ctx, "viewer", appID, 1, 2)
+	if err != nil {
+		t.Fatalf("DiffRoleVersions() error = %v", err)
+	}
+	if diff.Name == nil || diff.Name.From != "viewer" || diff.Name.To != "Viewers" {
+		t.Errorf("DiffRoleVersions() name = %+v", diff.Name)
+	}
+	if !reflect.DeepEqual(diff.AddedPermissions, []string{"editor"}) || len(diff.RemovedPermissions) != 0 {
+		t.Errorf("DiffRoleVersions() added = %v, removed = %v", diff.AddedPermissions, diff.RemovedPermissions)
+	}
+
+	rolledBack, err := db.RollbackRole(ctx, "viewer", appID, 1)
+	if err != nil {
+		t.Fatalf("RollbackRole() error = %v", err)
+	}
+	if rolledBack.Name != "viewer" || len(rolledBack.Permissions) != 1 {
+		t.Errorf("RollbackRole() = %+v, want version 1", rolledBack)
+	}
+	versions, err := db.GetRoleVersions(ctx, "viewer", appID)
+	if err != nil {
+		t.Fatalf("GetRoleVersions() error = %v", err)
+	}
+	if len(versions) != 3 || versions[0].Version != 3 || !reflect.DeepEqual(versions[0].PermissionIDs, []string{"viewer"}) {
+		t.Errorf("GetRoleVersions() newest = %+v of %d", versions[0], len(versions))
+	}
+}
+
+func TestRollbackDeletedRole(t *testing.T) {
+	db := liveService(t)
+	ctx := liveContext()
+	appID := liveApp(t, db, "viewer")
+	alice := liveUser(t, db, appID, "alice", "viewer")
+
+	if err := db.DeleteRole(ctx, "viewer", appID); err != nil {
+		t.Fatalf("DeleteRole() error = %v", err)
+	}
+	if _, err := db.RollbackRole(ctx, "viewer", appID, 1); !errors.Is(err, database.ErrConflict) {
+		t.Errorf("RollbackRole() of a deleted role error = %v, want a conflict", err)
+	}
+	if ids := userRoleIDs(t, db, alice); len(ids) != 0 {
+		t.Errorf("user roles after rejected rollback = %v, want none", ids)
+	}
+	if _, err := db.RollbackRole(ctx, "ghost", appID, 1); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("RollbackRole() of a missing role error = %v, want not found", err)
+	}
+}
@@ -0,0 +1,100 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"guardian/internal/database"
+	"guardian/internal/model"
+	"testing"
+)
+
+func userRoleIDs(t *testing.T, db database.Service, userName string) []string {
+	t.Helper()
+	user, err := db.GetUser(context.Background(), userName, nil)
+	if err != nil {
+		t.Fatalf("GetUser() error = %v", err)
+	}
+	ids := make([]string, 0, len(user.Roles))
+	for _, role := range user.Roles {
+		ids = append(ids, role.ID)
+	}
+	return ids
+}
+
+func TestUpsertDoesNotRestore(t *testing.T) {
+	db := liveService(t)
+	ctx := liveContext()
+	appID := liveApp(t, db, "viewer")
+	alice := liveUser(t, db, appID, "alice", "viewer")
+
+	if err := db.DeleteRole(ctx, "viewer", appID); err != nil {
+		t.Fatalf("DeleteRole() error = %v", err)
+	}
+	role := &model.Role{ID: "viewer", AppID: appID, Name: "viewer", Permissions: make([]*model.Permission, 0)}
+	if err := db.UpsertRole(ctx, role); !errors.Is(err, database.ErrConflict) {
+		t.Errorf("UpsertRole() of a deleted role error = %v, want a conflict", err)
+	}
+	if ids := userRoleIDs(t, db, alice); len(ids) != 0 {
+		t.Errorf("user roles after rejected upsert = %v, want none", ids)
+	}
+
+	if err := db.RestoreRole(ctx, "viewer", appID); err != nil {
+		t.Fatalf("RestoreRole() error = %v", err)
+	}
+	if ids := userRoleIDs(t, db, alice); len(ids) != 1 || ids[0] != "viewer" {
+		t.Errorf("user roles after restore = %v, want [viewer]", ids)
+	}
+}
+
+func TestRestoreAppCascade(t *testing.T) {
+	db := liveService(t)
+	ctx := liveContext()
+	appID := liveApp(t, db, "viewer", "editor")
+	alice := liveUser(t, db, appID, "alice", "viewer", "editor")
+
+	// editor is deleted on its own first, so restoring the app leaves it.
+	if err := db.DeleteRole(ctx, "editor", appID); err != nil {
+		t.Fatalf("DeleteRole() error = %v", err)
+	}
+	if err := db.DeleteApp(ctx, appID); err != nil {
+		t.Fatalf("DeleteApp() error = %v", err)
+	}
+	if _, err := db.GetRole(ctx, "viewer", appID); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("GetRole() in a deleted app error = %v, want not found", err)
+	}
+	if err := db.RestoreApp(ctx, appID); err != nil {
+		t.Fatalf("RestoreApp() error = %v", err)
+	}
+	if _, err := db.GetRole(ctx, "viewer", appID); err != nil {
+		t.Errorf("GetRole(viewer) after restore error = %v", err)
+	}
+	if _, err := db.GetRole(ctx, "editor", appID); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("GetRole(editor) after restore error = %v, want not found", err)
+	}
+	if ids := userRoleIDs(t, db, alice); len(ids) != 1 || ids[0] != "viewer" {
+		t.Errorf("user roles after restore = %v, want [viewer]", ids)
+	}
+}
+
+func TestPurgeDeleted(t *testing.T) {
+	db := liveService(t)
+	ctx := liveContext()
+	appID := liveApp(t, db, "viewer")
+	if err := db.DeleteRole(ctx, "viewer", appID); err != nil {
+		t.Fatalf("DeleteRole() error = %v", err)
+	}
+	result, err := db.PurgeDeleted(ctx, 0)
+	if err != nil {
+		t.Fatalf("PurgeDeleted() error = %v", err)
+	}
+	if result.Roles < 1 {
+		t.Errorf("PurgeDeleted() roles = %d, want at least 1", result.Roles)
+	}
+	if err := db.RestoreRole(ctx, "viewer", appID); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("RestoreRole() after purge error = %v, want not found", err)
+	}
+	role := &model.Role{ID: "viewer", AppID: appID, Name: "viewer", Permissions: make([]*model.Permission, 0)}
+	if err := db.CreateRole(ctx, role); err != nil {
+		t.Errorf("CreateRole() after purge error = %v", err)
+	}
+}
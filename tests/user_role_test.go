@@ -0,0 +1,46 @@
+package tests
+
+import (
+	"errors"
+	"guardian/internal/database"
+	"reflect"
+	"testing"
+)
+
+func TestGrantRevokeUserRole(t *testing.T) {
+	db := liveService(t)
+	ctx := liveContext()
+	appID := liveApp(t, db, "r1", "r2")
+	alice := liveUser(t, db, appID, "alice", "r1")
+
+	steps := []struct {
+		name    string
+		do      func() (bool, error)
+		changed bool
+		roles   []string
+	}{
+		{"grant", func() (bool, error) { return db.GrantUserRole(ctx, alice, "r2", appID) }, true, []string{"r1", "r2"}},
+		{"grant again", func() (bool, error) { return db.GrantUserRole(ctx, alice, "r2", appID) }, false, []string{"r1", "r2"}},
+		{"revoke", func() (bool, error) { return db.RevokeUserRole(ctx, alice, "r1", appID) }, true, []string{"r2"}},
+		{"revoke again", func() (bool, error) { return db.RevokeUserRole(ctx, alice, "r1", appID) }, false, []string{"r2"}},
+	}
+	for _, step := range steps {
+		changed, err := step.do()
+		if err != nil {
+			t.Fatalf("%s: error = %v", step.name, err)
+		}
+		if changed != step.changed {
+			t.Errorf("%s: changed = %v, want %v", step.name, changed, step.changed)
+		}
+		if roles := userRoleIDs(t, db, alice); !reflect.DeepEqual(roles, step.roles) {
+			t.Errorf("%s: roles = %v, want %v", step.name, roles, step.roles)
+		}
+	}
+
+	if _, err := db.GrantUserRole(ctx, alice, "missing", appID); !errors.Is(err, database.ErrInvalidReference) {
+		t.Errorf("GrantUserRole(missing role) error = %v, want ErrInvalidReference", err)
+	}
+	if _, err := db.GrantUserRole(ctx, "nobody@"+appID, "r1", appID); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("GrantUserRole(missing user) error = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,115 @@
+package tests
+
+import (
+	"errors"
+	"guardian/internal/model"
+	"guardian/internal/validation"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fieldCodes flattens validation errors into "field:code" pairs.
+func fieldCodes(t *testing.T, err error) []string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	var errs validation.Errors
+	if !errors.As(err, &errs) {
+		t.Fatalf("error %v is not validation.Errors", err)
+	}
+	codes := make([]string, 0, len(errs))
+	for _, e := range errs {
+		codes = append(codes, e.Field+":"+e.Code)
+	}
+	return codes
+}
+
+func TestValidateApplication(t *testing.T) {
+	cases := []struct {
+		app  *model.Application
+		want []string
+	}{
+		{&model.Application{ID: "crm", Name: "CRM"}, nil},
+		{&model.Application{ID: "crm.v2:eu-1", Name: "CRM", Description: "Sales"}, nil},
+		{&model.Application{}, []string{"id:required", "name:required"}},
+		{&model.Application{ID: "crm/admin", Name: "CRM"}, []string{"id:invalid_format"}},
+		{&model.Application{ID: "-crm", Name: "CRM"}, []string{"id:invalid_format"}},
+		{&model.Application{ID: "crm", Name: strings.Repeat("n", 256)}, []string{"name:too_long"}},
+		{&model.Application{ID: "crm", Name: strings.Repeat("é", 255)}, nil},
+	}
+
+	for _, tc := range cases {
+		if got := fieldCodes(t, validation.Application(tc.app)); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("Application(%+v) = %v, want %v", tc.app, got, tc.want)
+		}
+	}
+}
+
+func TestValidateRole(t *testing.T) {
+	role := &model.Role{
+		ID:    "admin",
+		AppID: "crm",
+		Name:  "Admin",
+		Permissions: []*model.Permission{
+			{ID: "read"},
+			{ID: "write", AppID: "crm"},
+			{ID: "delete", AppID: "billing"},
+			{ID: "read", AppID: "crm"},
+			{ID: ""},
+		},
+	}
+	want := []string{
+		"permissions[2].app_id:app_mismatch",
+		"permissions[3].id:duplicate",
+		"permissions[4].id:required",
+	}
+	if got := fieldCodes(t, validation.Role(role)); !reflect.DeepEqual(got, want) {
+		t.Errorf("Role() = %v, want %v", got, want)
+	}
+}
+
+func TestValidateUser(t *testing.T) {
+	user := &model.User{
+		UserName: "jane.doe+ops@example.com",
+		Roles: []*model.Role{
+			{ID: "admin", AppID: "crm"},
+			{ID: "admin", AppID: "billing"},
+			{ID: "admin", AppID: "crm"},
+			{ID: "viewer"},
+		},
+	}
+	want := []string{
+		"roles[2]:duplicate",
+		"roles[3].app_id:required",
+	}
+	if got := fieldCodes(t, validation.User(user)); !reflect.DeepEqual(got, want) {
+		t.Errorf("User() = %v, want %v", got, want)
+	}
+
+	if got := fieldCodes(t, validation.User(&model.User{UserName: "jane doe"})); !reflect.DeepEqual(got, []string{"username:invalid_format"}) {
+		t.Errorf("User() = %v, want username:invalid_format", got)
+	}
+}
+
+func TestValidateLegacyReferences(t *testing.T) {
+	role := &model.Role{ID: "admin", AppID: "crm", Name: "Admin", Permissions: []*model.Permission{{ID: "legacy perm"}}}
+	if got := fieldCodes(t, validation.Role(role)); got != nil {
+		t.Errorf("Role() = %v, want references to existing permissions accepted", got)
+	}
+	user := &model.User{UserName: "jane", Roles: []*model.Role{{ID: "legacy role", AppID: "old app"}}}
+	if got := fieldCodes(t, validation.User(user)); got != nil {
+		t.Errorf("User() = %v, want references to existing roles accepted", got)
+	}
+}
+
+func TestValidationExcept(t *testing.T) {
+	err := validation.Application(&model.Application{ID: "legacy app"})
+	if got := fieldCodes(t, validation.Except(err, "id")); !reflect.DeepEqual(got, []string{"name:required"}) {
+		t.Errorf("Except(id) = %v, want name:required", got)
+	}
+	if err := validation.Except(err, "id", "name"); err != nil {
+		t.Errorf("Except(id, name) = %v, want nil", err)
+	}
+}
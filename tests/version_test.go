@@ -0,0 +1,69 @@
+package tests
+
+import (
+	"errors"
+	"guardian/internal/database"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExpectedVersion(t *testing.T) {
+	db := liveService(t)
+	ctx := liveContext()
+	appID := liveApp(t, db, "viewer")
+
+	perm, err := db.GetPerm(ctx, "viewer", appID)
+	if err != nil {
+		t.Fatalf("GetPerm() error = %v", err)
+	}
+	stale := perm.Version
+
+	perm.Name = "Viewer"
+	if err := db.ReplacePerm(database.WithExpectedVersion(ctx, stale), perm); err != nil {
+		t.Fatalf("ReplacePerm(version %d) error = %v", stale, err)
+	}
+	perm.Name = "Reader"
+	if err := db.ReplacePerm(database.WithExpectedVersion(ctx, stale), perm); !errors.Is(err, database.ErrPreconditionFailed) {
+		t.Errorf("ReplacePerm(stale version %d) error = %v, want ErrPreconditionFailed", stale, err)
+	}
+	if got, _ := db.GetPerm(ctx, "viewer", appID); got == nil || got.Name != "Viewer" || got.Version != stale+1 {
+		t.Errorf("GetPerm() = %+v, want the first replace only", got)
+	}
+}
+
+func TestIfMatch(t *testing.T) {
+	db := liveService(t)
+	appID := liveApp(t, db, "viewer")
+	handler := authedHandler(t, db)
+	path := "/permissions/viewer/" + appID
+
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, path, nil))
+	tag := resp.Header().Get("ETag")
+	if resp.Code != http.StatusOK || tag == "" {
+		t.Fatalf("GET %s = %d, ETag %q; want 200 with an ETag", path, resp.Code, tag)
+	}
+
+	put := func(match string) *httptest.ResponseRecorder {
+		body := `{"id":"viewer","app_id":"` + appID + `","name":"Viewer"}`
+		req := authorize(httptest.NewRequest(http.MethodPut, path, strings.NewReader(body)), testToken)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", match)
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		return resp
+	}
+	if resp := put(tag); resp.Code != http.StatusOK || resp.Header().Get("ETag") == tag {
+		t.Errorf("PUT If-Match %s = %d, ETag %q; want 200 with a new ETag", tag, resp.Code, resp.Header().Get("ETag"))
+	}
+	if resp := put(tag); resp.Code != http.StatusPreconditionFailed {
+		t.Errorf("PUT stale If-Match %s = %d, want %d", tag, resp.Code, http.StatusPreconditionFailed)
+	}
+
+	perm, err := db.GetPerm(liveContext(), "viewer", appID)
+	if err != nil || perm.Name != "Viewer" {
+		t.Errorf("GetPerm() = %+v, %v; want the first PUT applied", perm, err)
+	}
+}